@@ -0,0 +1,278 @@
+package sqldb
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheBackend : storage of cached select results
+type CacheBackend interface {
+	Get(key string) (*OrderedRows, bool)
+	Set(key string, rows *OrderedRows, tables []string, ttl time.Duration)
+	InvalidateTable(table string) // forget the results read from a table
+}
+
+// CacheOptions : caching of select results, invalidated when the package writes to their tables
+type CacheOptions struct {
+	Backend CacheBackend
+	TTL     time.Duration // lifetime of the results, unlimited when zero
+	Tables  []string      // only cache selects reading these tables, every select when empty
+}
+
+// queryCache : cache options of a database, with the generation of each table
+type queryCache struct {
+	CacheOptions
+	identity    string // database the results are read from, as backends may be shared
+	mutex       sync.Mutex
+	generations map[string]uint64 // bumped on each invalidation, so a select that raced a write is not cached
+}
+
+// SetCache : Cache the results of selects, nil backend to disable
+func (db *Db) SetCache(opts CacheOptions) {
+	if opts.Backend == nil {
+		db.cache = nil
+		return
+	}
+	// the url may carry a password, keys only carry its hash
+	url := sha256.Sum256([]byte(db.Url))
+	db.cache = &queryCache{
+		CacheOptions: opts,
+		identity:     db.Driver + ":" + hex.EncodeToString(url[:8]),
+		generations:  make(map[string]uint64),
+	}
+}
+
+var (
+	fromTables = regexp.MustCompile(`(?i)\bfrom\s+([\w."\[\]]+(?:\s+(?:as\s+)?\w+)?(?:\s*,\s*[\w."\[\]]+(?:\s+(?:as\s+)?\w+)?)*)`)
+	joinTables = regexp.MustCompile(`(?i)\bjoin\s+([\w."\[\]]+)`)
+	spaces     = regexp.MustCompile(`\s+`)
+	// catalogs change with DDL, which tells no table to invalidate
+	catalogTables = regexp.MustCompile(`(?i)\b(?:information_schema|pg_catalog|pg_\w+|sys)\.|\bpg_\w+\(`)
+)
+
+// cacheKey : key of a select, its normalized statement and arguments, and the tables it reads
+func cacheKey(query string, args []interface{}) (string, []string) {
+	key := strings.TrimRight(strings.TrimSpace(spaces.ReplaceAllString(query, " ")), ";")
+	if len(args) > 0 {
+		key += fmt.Sprintf(" %#v", args)
+	}
+	var tables []string
+	// every table of a FROM list, joined by commas
+	for _, match := range fromTables.FindAllStringSubmatch(query, -1) {
+		for _, item := range strings.Split(match[1], ",") {
+			tables = append(tables, cacheTable(strings.Fields(item)[0]))
+		}
+	}
+	for _, match := range joinTables.FindAllStringSubmatch(query, -1) {
+		tables = append(tables, cacheTable(match[1]))
+	}
+	return key, tables
+}
+
+// cachedQuery : Provide the result of a select from the cache, or run it and cache it
+func (db *Db) cachedQuery(query string, run func() (*OrderedRows, error)) (*OrderedRows, error) {
+	opts := db.cache
+	if opts == nil || db.tx != nil {
+		return run()
+	}
+	if operation, _ := statementInfo(query); operation != "select" || catalogTables.MatchString(query) {
+		return run()
+	}
+	key, tables := cacheKey(query, nil)
+	// a select of no table, as of a function or a sequence, is invalidated by no write
+	if len(tables) == 0 || (len(opts.Tables) > 0 && !readsAny(tables, opts.Tables)) {
+		return run()
+	}
+	// views of other schemas read other tables
+	key = opts.identity + "/" + db.schema + " " + key
+	if rows, ok := opts.Backend.Get(key); ok {
+		return rows.clone(), nil
+	}
+	generations := opts.generationsOf(tables)
+	rows, err := run()
+	if err != nil {
+		return nil, err
+	}
+	opts.mutex.Lock()
+	defer opts.mutex.Unlock()
+	for i, table := range tables {
+		if opts.generations[table] != generations[i] {
+			// written since the select started, its rows may be stale
+			return rows, nil
+		}
+	}
+	opts.Backend.Set(key, rows.clone(), tables, opts.TTL)
+	return rows, nil
+}
+
+// generationsOf : current generation of some tables
+func (c *queryCache) generationsOf(tables []string) []uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	generations := make([]uint64, len(tables))
+	for i, table := range tables {
+		generations[i] = c.generations[table]
+	}
+	return generations
+}
+
+// invalidate : Forget the cached results of a table, and the results of the selects running on it
+func (c *queryCache) invalidate(table string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generations[table]++
+	c.Backend.InvalidateTable(table)
+}
+
+// cacheTable : name of a table in the cache, lower case and without schema
+func cacheTable(name string) string {
+	name = strings.ToLower(strings.Trim(name, `"[]`))
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = strings.Trim(name[i+1:], `"[]`)
+	}
+	return name
+}
+
+func readsAny(tables []string, cached []string) bool {
+	for _, table := range tables {
+		for _, name := range cached {
+			if table == cacheTable(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// invalidateCache : Forget the cached results of a table written by a statement
+func (db *Db) invalidateCache(event *QueryEvent) {
+	if db.cache == nil || event.Err != nil {
+		return
+	}
+	operation, table := statementInfo(event.Query)
+	if table == "" || operation == "select" || operation == "other" {
+		return
+	}
+	tables := []string{table}
+	if operation != "ddl" {
+		// data modifying CTEs write other tables than the main statement
+		tables = writtenTables(event.Query)
+	}
+	for _, table := range tables {
+		table = cacheTable(table)
+		db.cache.invalidate(table)
+		// a select run before the commit would cache the previous rows again
+		if db.txWrites != nil {
+			db.txWrites[table] = true
+		}
+	}
+}
+
+// clone : copy of the rows, so cached results are not altered by callers
+func (r *OrderedRows) clone() *OrderedRows {
+	res := &OrderedRows{Columns: r.Columns, Values: make([][]interface{}, len(r.Values))}
+	for i, values := range r.Values {
+		res.Values[i] = append([]interface{}(nil), values...)
+	}
+	return res
+}
+
+// LRUCache : in memory CacheBackend dropping the least recently used results beyond its size
+type LRUCache struct {
+	mutex   sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List // most recently used first
+	tables  map[string]map[string]bool
+}
+
+type cacheEntry struct {
+	key     string
+	rows    *OrderedRows
+	tables  []string
+	expires time.Time // zero for no expiry
+}
+
+// NewLRUCache : Create an in memory cache of at most size results
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		tables:  make(map[string]map[string]bool),
+	}
+}
+
+// Get : Provide a cached result
+func (c *LRUCache) Get(key string) (*OrderedRows, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.remove(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.rows, true
+}
+
+// Set : Cache a result read from some tables
+func (c *LRUCache) Set(key string, rows *OrderedRows, tables []string, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	entry := &cacheEntry{key: key, rows: rows, tables: tables}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for _, table := range tables {
+		if c.tables[table] == nil {
+			c.tables[table] = make(map[string]bool)
+		}
+		c.tables[table][key] = true
+	}
+	for c.size > 0 && c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// InvalidateTable : Forget the results read from a table
+func (c *LRUCache) InvalidateTable(table string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key := range c.tables[table] {
+		if element, ok := c.entries[key]; ok {
+			c.remove(element)
+		}
+	}
+	delete(c.tables, table)
+}
+
+// Len : number of cached results
+func (c *LRUCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRUCache) remove(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+	c.order.Remove(element)
+	delete(c.entries, entry.key)
+	for _, table := range entry.tables {
+		delete(c.tables[table], entry.key)
+	}
+}
@@ -0,0 +1,316 @@
+package sqldb
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Converter : Convert a value scanned from the database to its Go representation
+type Converter func(value interface{}) (interface{}, error)
+
+// Go representations of the database values, whatever the driver :
+//   - integers are int64, unsigned mysql integers uint64
+//   - floating point numbers are float64
+//   - NUMERIC, DECIMAL and MONEY are strings, not to lose precision
+//   - UUID and UNIQUEIDENTIFIER are canonical lower case strings
+//   - JSON and JSONB are json.RawMessage
+//   - BIT(1) and booleans are bool, wider mysql BIT are uint64, mysql TINYINT(1) booleans are int64 as other TINYINT
+//     and are only told apart by the column type of the table schema
+//   - dates and timestamps are time.Time, times of day are strings
+//   - binary columns are []byte, mysql VARBINARY excepted for compatibility
+//   - postgres arrays are []int64, []float64, []bool or []string
+//   - other text types are strings
+var converters = map[string]map[string]Converter{
+	"postgres": {
+		"INT2": toInt, "INT4": toInt, "INT8": toInt, "OID": toInt,
+		"FLOAT4": toFloat, "FLOAT8": toFloat,
+		"NUMERIC": toDecimal, "MONEY": pgToMoney,
+		"BOOL": toBool, "BIT": pgToBit, "VARBIT": pgToBit,
+		"VARCHAR": toString, "TEXT": toString, "BPCHAR": toString, "CHAR": toString, "NAME": toString, "XML": toString,
+		"DATE": toTime, "TIMESTAMP": toTime, "TIMESTAMPTZ": toTime,
+		"TIME": toTimeOfDay, "TIMETZ": toTimeOfDay,
+		"UUID": toUUID, "JSON": toJSON, "JSONB": toJSON, "BYTEA": toBytes,
+		"_INT2": toIntArray, "_INT4": toIntArray, "_INT8": toIntArray,
+		"_FLOAT4": toFloatArray, "_FLOAT8": toFloatArray, "_BOOL": toBoolArray,
+		"_NUMERIC": toStringArray, "_TEXT": toStringArray, "_VARCHAR": toStringArray, "_BPCHAR": toStringArray, "_UUID": toStringArray,
+	},
+	"mysql": {
+		"TINYINT": toInt, "SMALLINT": toInt, "MEDIUMINT": toInt, "INT": toInt, "BIGINT": toInt, "YEAR": toInt,
+		"UNSIGNED TINYINT": toUint, "UNSIGNED SMALLINT": toUint, "UNSIGNED MEDIUMINT": toUint, "UNSIGNED INT": toUint, "UNSIGNED BIGINT": toUint,
+		"FLOAT": toFloat, "DOUBLE": toFloat, "DECIMAL": toDecimal, "BIT": myToBit,
+		"CHAR": toString, "VARCHAR": toString, "TINYTEXT": toString, "TEXT": toString, "MEDIUMTEXT": toString, "LONGTEXT": toString,
+		"ENUM": toString, "SET": toString, "VARBINARY": toString,
+		"DATE": toTime, "DATETIME": toTime, "TIMESTAMP": toTime, "TIME": toTimeOfDay, "JSON": toJSON,
+		"BINARY": toBytes, "TINYBLOB": toBytes, "BLOB": toBytes, "MEDIUMBLOB": toBytes, "LONGBLOB": toBytes,
+	},
+	"sqlserver": {
+		"TINYINT": toInt, "SMALLINT": toInt, "INT": toInt, "BIGINT": toInt,
+		"REAL": toFloat, "FLOAT": toFloat,
+		"DECIMAL": toDecimal, "NUMERIC": toDecimal, "MONEY": toDecimal, "SMALLMONEY": toDecimal, "BIT": toBool,
+		"CHAR": toString, "VARCHAR": toString, "TEXT": toString, "NCHAR": toString, "NVARCHAR": toString, "NTEXT": toString, "XML": toString,
+		"DATE": toTime, "DATETIME": toTime, "DATETIME2": toTime, "SMALLDATETIME": toTime, "DATETIMEOFFSET": toTime,
+		"TIME": toTimeOfDay, "UNIQUEIDENTIFIER": msToUUID,
+		"BINARY": toBytes, "VARBINARY": toBytes, "IMAGE": toBytes,
+	},
+}
+
+// RegisterConverter : Replace the conversion of a database type, as named by the driver, for this database
+func (db *Db) RegisterConverter(databaseType string, converter Converter) {
+	if db.converters == nil {
+		db.converters = make(map[string]Converter)
+	}
+	db.converters[strings.ToUpper(databaseType)] = converter
+}
+
+// convertValue : Convert a scanned value according to the database type of its column
+func (db *Db) convertValue(databaseType string, val interface{}) (interface{}, error) {
+	if val == nil {
+		return nil, nil
+	}
+	converter, ok := db.converters[databaseType]
+	if !ok {
+		converter, ok = converters[db.Driver][databaseType]
+	}
+	if ok {
+		return converter(val)
+	}
+	// unknown types are passed through, raw bytes as text
+	if b, isBytes := val.([]byte); isBytes {
+		return string(b), nil
+	}
+	return val, nil
+}
+
+// text : textual form of a value received as bytes or string
+func text(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case []byte:
+		return string(v), true
+	case string:
+		return v, true
+	}
+	return "", false
+}
+
+func toInt(value interface{}) (interface{}, error) {
+	if str, ok := text(value); ok {
+		return strconv.ParseInt(strings.TrimSpace(str), 10, 64)
+	}
+	if i, ok := toInt64(value); ok {
+		return i, nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to int64", value)
+}
+
+func toUint(value interface{}) (interface{}, error) {
+	if str, ok := text(value); ok {
+		return strconv.ParseUint(strings.TrimSpace(str), 10, 64)
+	}
+	if i, ok := toInt64(value); ok && i >= 0 {
+		return uint64(i), nil
+	}
+	if u, ok := value.(uint64); ok {
+		return u, nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to uint64", value)
+}
+
+func toFloat(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	}
+	if str, ok := text(value); ok {
+		return strconv.ParseFloat(strings.TrimSpace(str), 64)
+	}
+	if i, ok := toInt64(value); ok {
+		return float64(i), nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to float64", value)
+}
+
+func toDecimal(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	}
+	if str, ok := text(value); ok {
+		return strings.TrimSpace(str), nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to decimal", value)
+}
+
+// pgToMoney : postgres formats money with a currency symbol and group separators
+func pgToMoney(value interface{}) (interface{}, error) {
+	str, ok := text(value)
+	if !ok {
+		return toDecimal(value)
+	}
+	return strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || r == '.' || r == '-' {
+			return r
+		}
+		return -1
+	}, str), nil
+}
+
+func toBool(value interface{}) (interface{}, error) {
+	if b, ok := value.(bool); ok {
+		return b, nil
+	}
+	if str, ok := text(value); ok {
+		if i, err := strconv.ParseInt(strings.TrimSpace(str), 10, 64); err == nil {
+			return i != 0, nil
+		}
+		return parseBool(strings.TrimSpace(str))
+	}
+	if i, ok := toInt64(value); ok {
+		return i != 0, nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to bool", value)
+}
+
+// pgToBit : postgres sends bit strings as text
+func pgToBit(value interface{}) (interface{}, error) {
+	str, ok := text(value)
+	if !ok {
+		return toBool(value)
+	}
+	if len(str) == 1 {
+		return str == "1", nil
+	}
+	return str, nil
+}
+
+// myToBit : mysql sends bit values as big endian bytes
+func myToBit(value interface{}) (interface{}, error) {
+	b, ok := value.([]byte)
+	if !ok {
+		return toBool(value)
+	}
+	if len(b) == 1 && b[0] <= 1 {
+		return b[0] == 1, nil
+	}
+	if len(b) > 8 {
+		return nil, fmt.Errorf("bit value of %d bytes", len(b))
+	}
+	var buf [8]byte
+	copy(buf[8-len(b):], b)
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func toString(value interface{}) (interface{}, error) {
+	if str, ok := text(value); ok {
+		return str, nil
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+var timeLayouts = []string{"2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999Z07:00", "2006-01-02T15:04:05.999999999", "2006-01-02"}
+
+func toTime(value interface{}) (interface{}, error) {
+	if t, ok := value.(time.Time); ok {
+		return t, nil
+	}
+	if str, ok := text(value); ok {
+		// mysql zero dates have no time.Time equivalent
+		if strings.HasPrefix(str, "0000-00-00") {
+			return time.Time{}, nil
+		}
+		return parseTime(strings.TrimSpace(str), timeLayouts)
+	}
+	return nil, fmt.Errorf("cannot convert %T to time.Time", value)
+}
+
+func toTimeOfDay(value interface{}) (interface{}, error) {
+	if t, ok := value.(time.Time); ok {
+		return t.Format("15:04:05.999999999"), nil
+	}
+	return toString(value)
+}
+
+func toUUID(value interface{}) (interface{}, error) {
+	if b, ok := value.([]byte); ok && len(b) == 16 {
+		return formatUUID(b), nil
+	}
+	if str, ok := text(value); ok {
+		return strings.ToLower(strings.Trim(str, "{}")), nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to uuid", value)
+}
+
+// msToUUID : sqlserver stores the first three groups of a uniqueidentifier little endian
+func msToUUID(value interface{}) (interface{}, error) {
+	b, ok := value.([]byte)
+	if !ok || len(b) != 16 {
+		return toUUID(value)
+	}
+	u := make([]byte, 16)
+	copy(u, b)
+	u[0], u[1], u[2], u[3] = b[3], b[2], b[1], b[0]
+	u[4], u[5] = b[5], b[4]
+	u[6], u[7] = b[7], b[6]
+	return formatUUID(u), nil
+}
+
+func formatUUID(b []byte) string {
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+func toJSON(value interface{}) (interface{}, error) {
+	if str, ok := text(value); ok {
+		if !json.Valid([]byte(str)) {
+			return nil, fmt.Errorf("invalid json value")
+		}
+		return json.RawMessage(str), nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to json", value)
+}
+
+func toBytes(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case []byte:
+		b := make([]byte, len(v))
+		copy(b, v)
+		return b, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to []byte", value)
+}
+
+func toIntArray(value interface{}) (interface{}, error) {
+	var a pq.Int64Array
+	err := a.Scan(value)
+	return []int64(a), err
+}
+
+func toFloatArray(value interface{}) (interface{}, error) {
+	var a pq.Float64Array
+	err := a.Scan(value)
+	return []float64(a), err
+}
+
+func toBoolArray(value interface{}) (interface{}, error) {
+	var a pq.BoolArray
+	err := a.Scan(value)
+	return []bool(a), err
+}
+
+func toStringArray(value interface{}) (interface{}, error) {
+	var a pq.StringArray
+	err := a.Scan(value)
+	return []string(a), err
+}
@@ -0,0 +1,352 @@
+package sqldb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CopyOptions : tune a copy between two databases
+type CopyOptions struct {
+	Tables    []string // tables to copy, every source table when empty
+	BatchSize int      // rows read and inserted at once, 500 when not set
+	Truncate  bool     // empty the destination tables before copying
+}
+
+// CopyResult : outcome of the copy of one table
+type CopyResult struct {
+	Table           string   `json:"table"`
+	Created         bool     `json:"created"`
+	SourceRows      int64    `json:"source_rows"`
+	CopiedRows      int64    `json:"copied_rows"`
+	DestinationRows int64    `json:"destination_rows"`
+	MissingColumns  []string `json:"missing_columns,omitempty"`
+	Mismatch        bool     `json:"mismatch"`
+}
+
+// Copy : Copy tables and rows from a database to another one, whatever their drivers
+func Copy(src *Db, dst *Db, opts CopyOptions) ([]CopyResult, error) {
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 500
+	}
+	if dst.Driver == "sqlserver" && opts.BatchSize > 1000 {
+		opts.BatchSize = 1000
+	}
+	schema, err := src.dumpSchema(opts.Tables)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := dst.ListTables()
+	if err != nil {
+		return nil, err
+	}
+	dstTables := make(map[string]bool)
+	for _, row := range existing {
+		dstTables[strings.ToLower(fmt.Sprintf("%v", row["name"]))] = true
+	}
+	var results []CopyResult
+	for _, ti := range schema {
+		result, err := copyTable(src, dst, ti, dstTables[strings.ToLower(ti.Name)], opts)
+		results = append(results, result)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+func copyTable(src *Db, dst *Db, ti TableInfo, exists bool, opts CopyOptions) (CopyResult, error) {
+	result := CopyResult{Table: ti.Name}
+	var dstColumns map[string]string
+	if exists {
+		dstti, err := dst.Table(ti.Name).GetSchema()
+		if err != nil {
+			return result, err
+		}
+		dstColumns = dstti.Columns
+	} else {
+		translated := TableInfo{Name: ti.Name, Columns: make(map[string]string), order: ti.ColumnNames()}
+		for name, sqltype := range ti.Columns {
+			translated.Columns[name] = TranslateType(src.Driver, dst.Driver, sqltype)
+		}
+		err := dst.CreateTable(translated)
+		if err != nil {
+			return result, err
+		}
+		result.Created = true
+		dstColumns = translated.Columns
+	}
+	var columns []string
+	for _, name := range ti.ColumnNames() {
+		if _, ok := dstColumns[name]; ok {
+			columns = append(columns, name)
+		} else {
+			result.MissingColumns = append(result.MissingColumns, name)
+		}
+	}
+	if len(columns) == 0 {
+		return result, errors.New("copy: no common column for table " + ti.Name)
+	}
+	_, srcId := ti.Columns["id"]
+	_, dstId := dstColumns["id"]
+	hasId := srcId && dstId
+
+	var err error
+	result.SourceRows, err = src.countRows(ti.Name)
+	if err != nil {
+		return result, err
+	}
+
+	dstName := qualify(dst.schema, ti.Name)
+	tx, err := dst.conn.BeginTx(dst.Context(), nil)
+	if err != nil {
+		return result, err
+	}
+	exec := func(query string) error {
+		_, err := dst.exec(tx, query)
+		return err
+	}
+	fail := func(err error) (CopyResult, error) {
+		tx.Rollback()
+		return result, err
+	}
+	if opts.Truncate {
+		if err = exec("DELETE FROM " + dstName); err != nil {
+			return fail(err)
+		}
+	}
+	// identity columns only accept explicit values once enabled for the session
+	if dst.Driver == "sqlserver" && hasId {
+		if err = exec("SET IDENTITY_INSERT " + dstName + " ON"); err != nil {
+			return fail(err)
+		}
+	}
+	orderBy := columns[0]
+	if hasId {
+		orderBy = "id"
+	}
+	prefix := "INSERT INTO " + dstName + " (" + strings.Join(columns, ",") + ") VALUES "
+	for offset := 0; ; offset += opts.BatchSize {
+		rows, err := src.selectRows(src.pageQuery(src.Table(ti.Name).buildSelect("", columns, "", []string{}), orderBy, opts.BatchSize, offset))
+		if err != nil {
+			return fail(err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		values := make([]string, 0, len(rows))
+		for _, row := range rows {
+			literals := make([]string, len(columns))
+			for i, column := range columns {
+				literals[i] = dst.sqlLiteral(booleanValue(dst.Driver, dstColumns[column], row[column]))
+			}
+			values = append(values, "("+strings.Join(literals, ",")+")")
+		}
+		if err = exec(prefix + strings.Join(values, ",")); err != nil {
+			return fail(err)
+		}
+		result.CopiedRows += int64(len(rows))
+		if len(rows) < opts.BatchSize {
+			break
+		}
+	}
+	if dst.Driver == "sqlserver" && hasId {
+		if err = exec("SET IDENTITY_INSERT " + dstName + " OFF"); err != nil {
+			return fail(err)
+		}
+	}
+	if hasId {
+		var max int64
+		err = dst.queryRow(tx, "SELECT COALESCE(MAX(id), 0) FROM "+dstName, nil, &max)
+		if err != nil {
+			return fail(err)
+		}
+		if err = exec(dst.resetSequenceQuery(dstName, max)); err != nil {
+			return fail(err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return result, err
+	}
+	result.DestinationRows, err = dst.countRows(ti.Name)
+	if err != nil {
+		return result, err
+	}
+	result.Mismatch = result.SourceRows != result.CopiedRows || result.DestinationRows < result.CopiedRows
+	return result, nil
+}
+
+// countRows : number of rows of a table
+func (db *Db) countRows(table string) (int64, error) {
+	var count int64
+	err := db.queryRow(db.session(), "SELECT COUNT(*) FROM "+qualify(db.schema, table), nil, &count)
+	return count, err
+}
+
+// booleanValue : value for a column, integers as bool for a boolean column, mysql reading its tinyint(1) booleans as integers
+func booleanValue(driver string, sqltype string, value interface{}) interface{} {
+	base, args, _ := splitType(sqltype)
+	if generic, _ := genericType(driver, base, args); generic == "boolean" {
+		switch v := value.(type) {
+		case int64:
+			return v != 0
+		case uint64:
+			return v != 0
+		}
+	}
+	return value
+}
+
+// pageQuery : restrict a select to a page of rows
+func (db *Db) pageQuery(query string, orderBy string, limit int, offset int) string {
+	if db.Driver == "sqlserver" {
+		return query + " ORDER BY " + orderBy + " OFFSET " + strconv.Itoa(offset) + " ROWS FETCH NEXT " + strconv.Itoa(limit) + " ROWS ONLY"
+	}
+	return query + " ORDER BY " + orderBy + " LIMIT " + strconv.Itoa(limit) + " OFFSET " + strconv.Itoa(offset)
+}
+
+// generic types the dialect types are translated through
+var genericTypes = map[string]string{
+	"int":                         "integer",
+	"integer":                     "integer",
+	"int4":                        "integer",
+	"mediumint":                   "integer",
+	"serial":                      "integer",
+	"bigint":                      "bigint",
+	"int8":                        "bigint",
+	"bigserial":                   "bigint",
+	"smallint":                    "smallint",
+	"int2":                        "smallint",
+	"bool":                        "boolean",
+	"boolean":                     "boolean",
+	"bit":                         "boolean",
+	"real":                        "real",
+	"float4":                      "real",
+	"float":                       "double",
+	"float8":                      "double",
+	"double":                      "double",
+	"double precision":            "double",
+	"numeric":                     "decimal",
+	"decimal":                     "decimal",
+	"money":                       "decimal",
+	"varchar":                     "varchar",
+	"nvarchar":                    "varchar",
+	"character varying":           "varchar",
+	"char":                        "char",
+	"nchar":                       "char",
+	"character":                   "char",
+	"bpchar":                      "char",
+	"text":                        "text",
+	"ntext":                       "text",
+	"tinytext":                    "text",
+	"mediumtext":                  "text",
+	"longtext":                    "text",
+	"date":                        "date",
+	"time":                        "time",
+	"time without time zone":      "time",
+	"datetime":                    "timestamp",
+	"datetime2":                   "timestamp",
+	"smalldatetime":               "timestamp",
+	"timestamp":                   "timestamp",
+	"timestamp without time zone": "timestamp",
+	"timestamptz":                 "timestamptz",
+	"timestamp with time zone":    "timestamptz",
+	"datetimeoffset":              "timestamptz",
+	"bytea":                       "binary",
+	"blob":                        "binary",
+	"longblob":                    "binary",
+	"binary":                      "binary",
+	"varbinary":                   "binary",
+	"image":                       "binary",
+	"uuid":                        "uuid",
+	"uniqueidentifier":            "uuid",
+	"json":                        "json",
+	"jsonb":                       "json",
+}
+
+// dialect types of the generic types, %s receives the type arguments
+var dialectTypes = map[string]map[string]string{
+	"postgres": {
+		"integer": "integer", "bigint": "bigint", "smallint": "smallint", "boolean": "boolean",
+		"real": "real", "double": "double precision", "decimal": "numeric%s",
+		"varchar": "varchar%s", "char": "char%s", "text": "text",
+		"date": "date", "time": "time", "timestamp": "timestamp", "timestamptz": "timestamptz",
+		"binary": "bytea", "uuid": "uuid", "json": "jsonb",
+	},
+	"mysql": {
+		"integer": "int", "bigint": "bigint", "smallint": "smallint", "boolean": "boolean",
+		"real": "float", "double": "double", "decimal": "decimal%s",
+		"varchar": "varchar%s", "char": "char%s", "text": "longtext",
+		"date": "date", "time": "time", "timestamp": "datetime", "timestamptz": "datetime",
+		"binary": "longblob", "uuid": "char(36)", "json": "json",
+	},
+	"sqlserver": {
+		"integer": "int", "bigint": "bigint", "smallint": "smallint", "boolean": "bit",
+		"real": "real", "double": "float", "decimal": "decimal%s",
+		"varchar": "nvarchar%s", "char": "nchar%s", "text": "nvarchar(max)",
+		"date": "date", "time": "time", "timestamp": "datetime2", "timestamptz": "datetimeoffset",
+		"binary": "varbinary(max)", "uuid": "uniqueidentifier", "json": "nvarchar(max)",
+	},
+}
+
+// TranslateType : Translate a column type as provided by GetSchema from a driver dialect to another,
+// the comment part is kept
+func TranslateType(from string, to string, sqltype string) string {
+	base, args, comment := splitType(sqltype)
+	if comment != "" {
+		comment = "|" + comment
+	}
+	generic, ok := genericType(from, base, args)
+	target, known := dialectTypes[to]
+	if !ok || !known || from == to {
+		return sqltype
+	}
+	switch generic {
+	case "varchar", "char":
+		if args == "(-1)" || args == "(max)" {
+			generic, args = "text", ""
+		} else if n, err := strconv.Atoi(strings.Trim(args, "()")); err == nil && n > 4000 && to == "sqlserver" {
+			generic, args = "text", ""
+		} else if args == "" && to == "mysql" {
+			args = "(255)"
+		}
+	case "decimal":
+		// precision and scale are kept
+	default:
+		args = ""
+	}
+	if strings.Contains(target[generic], "%s") {
+		return fmt.Sprintf(target[generic], args) + comment
+	}
+	return target[generic] + comment
+}
+
+// splitType : split a GetSchema column type into its lowered base type, its arguments and its comment
+func splitType(sqltype string) (string, string, string) {
+	desc := strings.SplitN(sqltype, "|", 2)
+	comment := ""
+	if len(desc) > 1 {
+		comment = desc[1]
+	}
+	base := strings.ToLower(strings.TrimSpace(desc[0]))
+	args := ""
+	if i := strings.Index(base, "("); i >= 0 {
+		args = base[i:]
+		base = strings.TrimSpace(base[:i])
+	}
+	return strings.TrimSuffix(base, " unsigned"), args, comment
+}
+
+// genericType : generic type of a base type and its arguments in a driver dialect
+func genericType(driver string, base string, args string) (string, bool) {
+	// mysql stores booleans as tinyint(1), other tinyints are small integers
+	if base == "tinyint" {
+		if driver == "mysql" && strings.HasPrefix(args, "(1)") {
+			return "boolean", true
+		}
+		return "smallint", true
+	}
+	generic, ok := genericTypes[base]
+	return generic, ok
+}
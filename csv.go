@@ -0,0 +1,270 @@
+package sqldb
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVOptions : tune CSV import and export
+type CSVOptions struct {
+	Delimiter rune              // field delimiter, ',' when not set
+	Null      string            // token standing for NULL, empty field when not set
+	Mapping   map[string]string // header to column mapping, headers matching a column name need no entry
+	DryRun    bool              // check the rows without inserting them
+	// read a comma as the decimal separator of numbers, as spreadsheets of some locales write them,
+	// "1,5" being 1.5, numbers with a comma are rejected otherwise, "1,234" being ambiguous
+	DecimalComma bool
+}
+
+// ImportError : a row rejected during an import
+type ImportError struct {
+	Line   int    `json:"line"`
+	Column string `json:"column,omitempty"`
+	Err    string `json:"error"`
+}
+
+// ImportReport : outcome of a CSV or JSON import
+type ImportReport struct {
+	Rows     int           `json:"rows"`
+	Imported int           `json:"imported"`
+	Updated  int           `json:"updated"`
+	Ignored  []string      `json:"ignored,omitempty"` // headers or keys matching no column
+	Errors   []ImportError `json:"errors,omitempty"`
+}
+
+var dateLayouts = []string{"2006-01-02", "02/01/2006", "2006/01/02", time.RFC3339}
+
+var timestampLayouts = []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04", "02/01/2006 15:04:05", "02/01/2006 15:04", "2006-01-02"}
+
+// ExportCSV : Write table data as CSV, with a header line of the column names
+func (t *TableInfo) ExportCSV(w io.Writer, columns []string, restriction string, opts ...CSVOptions) error {
+	var opt CSVOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	schema, err := t.GetSchema()
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 || (len(columns) == 1 && columns[0] == "*") {
+		columns = schema.ColumnNames()
+	}
+	rows, err := t.GetAssociativeArray(columns, restriction, []string{}, "")
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if opt.Delimiter != 0 {
+		cw.Comma = opt.Delimiter
+	}
+	err = cw.Write(columns)
+	if err != nil {
+		return err
+	}
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, column := range columns {
+			record[i] = csvValue(schema.Columns[column], row[column], opt.Null)
+		}
+		err = cw.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvValue : text representation of a database value
+func csvValue(sqltype string, value interface{}, null string) string {
+	switch v := value.(type) {
+	case nil:
+		return null
+	case time.Time:
+		base, _, _ := splitType(sqltype)
+		if base == "date" {
+			return v.Format("2006-01-02")
+		}
+		return v.Format("2006-01-02 15:04:05.999999999")
+	case []byte:
+		return string(v)
+	case json.RawMessage:
+		return string(v)
+	case []int64, []float64, []bool, []string:
+		array, _ := json.Marshal(v)
+		return string(array)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// ImportCSV : Insert CSV rows in the table, the first line maps the fields to the columns
+func (t *TableInfo) ImportCSV(r io.Reader, opts CSVOptions) (*ImportReport, error) {
+	schema, err := t.GetSchema()
+	if err != nil {
+		return nil, err
+	}
+	if len(schema.Columns) == 0 {
+		return nil, errors.New("import: unknown table " + t.Name)
+	}
+	cr := csv.NewReader(r)
+	if opts.Delimiter != 0 {
+		cr.Comma = opts.Delimiter
+	}
+	cr.FieldsPerRecord = -1
+	headers, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	report := &ImportReport{}
+	columns := make([]string, len(headers))
+	for i, header := range headers {
+		columns[i] = schema.csvColumn(header, opts.Mapping)
+		if columns[i] == "" {
+			report.Ignored = append(report.Ignored, header)
+		}
+	}
+	if len(report.Ignored) == len(headers) {
+		return report, errors.New("import: no field maps to a column of " + t.Name)
+	}
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+		line, _ := cr.FieldPos(0)
+		report.Rows++
+		record, csverr := schema.csvRecord(columns, fields, opts)
+		if csverr != nil {
+			csverr.Line = line
+			report.Errors = append(report.Errors, *csverr)
+			continue
+		}
+		if opts.DryRun {
+			continue
+		}
+		_, err = t.Insert(record)
+		if err != nil {
+			report.Errors = append(report.Errors, ImportError{Line: line, Err: err.Error()})
+			continue
+		}
+		report.Imported++
+	}
+	return report, nil
+}
+
+// csvColumn : column receiving a CSV field, empty when the header matches no column
+func (t *TableInfo) csvColumn(header string, mapping map[string]string) string {
+	if column, ok := mapping[header]; ok {
+		return column
+	}
+	header = strings.TrimSpace(header)
+	if _, ok := t.Columns[header]; ok {
+		return header
+	}
+	for column := range t.Columns {
+		if strings.EqualFold(column, header) {
+			return column
+		}
+	}
+	return ""
+}
+
+func (t *TableInfo) csvRecord(columns []string, fields []string, opts CSVOptions) (AssRow, *ImportError) {
+	if len(fields) != len(columns) {
+		return nil, &ImportError{Err: fmt.Sprintf("%d fields, %d expected", len(fields), len(columns))}
+	}
+	record := make(AssRow)
+	for i, column := range columns {
+		if column == "" {
+			continue
+		}
+		if fields[i] == opts.Null {
+			record[column] = nil
+			continue
+		}
+		field := fields[i]
+		if opts.DecimalComma && strings.Count(field, ",") == 1 && !strings.Contains(field, ".") {
+			base, args, _ := splitType(t.Columns[column])
+			if generic, _ := genericType(t.db.Driver, base, args); generic == "real" || generic == "double" || generic == "decimal" {
+				field = strings.Replace(field, ",", ".", 1)
+			}
+		}
+		value, err := coerceValue(t.db.Driver, t.Columns[column], field)
+		if err != nil {
+			return nil, &ImportError{Column: column, Err: err.Error()}
+		}
+		record[column] = value
+	}
+	return record, nil
+}
+
+// coerceValue : Convert a text value to the Go type matching a column type
+func coerceValue(driver string, sqltype string, str string) (interface{}, error) {
+	base, args, _ := splitType(sqltype)
+	generic, _ := genericType(driver, base, args)
+	str = strings.TrimSpace(str)
+	switch generic {
+	case "integer", "bigint", "smallint":
+		return strconv.ParseInt(str, 10, 64)
+	case "real", "double", "decimal":
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return nil, err
+		}
+		// decimals are kept as text not to lose precision
+		if generic == "decimal" {
+			return str, nil
+		}
+		return f, nil
+	case "boolean":
+		return parseBool(str)
+	case "date":
+		d, err := parseTime(str, dateLayouts)
+		if err != nil {
+			return nil, err
+		}
+		return d.Format("2006-01-02"), nil
+	case "timestamp", "timestamptz":
+		d, err := parseTime(str, timestampLayouts)
+		if err != nil {
+			return nil, err
+		}
+		if generic == "timestamptz" {
+			return d.Format("2006-01-02 15:04:05.999999999Z07:00"), nil
+		}
+		return d.Format("2006-01-02 15:04:05.999999999"), nil
+	}
+	return str, nil
+}
+
+func parseBool(str string) (bool, error) {
+	switch strings.ToLower(str) {
+	case "1", "t", "true", "y", "yes", "on":
+		return true, nil
+	case "0", "f", "false", "n", "no", "off":
+		return false, nil
+	}
+	return false, errors.New("invalid boolean " + strconv.Quote(str))
+}
+
+func parseTime(str string, layouts []string) (time.Time, error) {
+	for _, layout := range layouts {
+		if d, err := time.Parse(layout, str); err == nil {
+			return d, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid date " + strconv.Quote(str))
+}
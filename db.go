@@ -1,13 +1,15 @@
 package sqldb
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"html/template"
 	"os"
-	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -20,10 +22,30 @@ import (
 var log zerolog.Logger
 
 type Db struct {
-	Driver     string
-	Url        string
-	LogQueries bool
-	conn       *sql.DB
+	Driver       string
+	Url          string
+	LogQueries   bool // log every statement
+	LogValues    bool // log statements with their literals and arguments, redacted otherwise
+	SlowQuery    SlowQueryOptions
+	Retry        RetryPolicy
+	conn         *sql.DB
+	converters   map[string]Converter
+	hooks        []Hook
+	logger       *zerolog.Logger
+	metrics      MetricsCollector
+	tracer       Tracer
+	ctx          context.Context
+	tx           *sql.Tx // transaction of the views given by WithTx
+	replicas     *replicaSet
+	cache        *queryCache
+	txWrites     map[string]bool // tables written in the transaction, for cache invalidation
+	schemas      *schemaCache
+	statements   *stmtCache
+	selects      *stmtCache // statements of the table selects, apart not to evict the others
+	prepare      bool       // prepare the selects of the view through the statement cache
+	schema       string     // schema of the view given by InSchema
+	schemaErr    error      // invalid schema of the view, returned by its statements
+	tenantPrefix string     // schemas of the tenants are named prefix + tenant
 }
 
 // AssRow : associative row type
@@ -35,16 +57,21 @@ type Rows []AssRow
 // Table is a table structure description
 type TableInfo struct {
 	Name    string            `json:"name"`
+	Schema  string            `json:"-"` // the one of the database view when empty, not serialized
 	Columns map[string]string `json:"columns"`
+	order   []string          // column names in ordinal position
 	db      *Db
 }
 
+// Link is a reference from a column of a table to another table
 type Link struct {
-	Source      string
-	Destination string
+	Source            string
+	Destination       string
+	SourceColumn      string
+	DestinationColumn string
 }
 
-// Open the database
+// Open the database, without checking it answers, see OpenWithOptions
 func Open(driver string, url string) *Db {
 	var database Db
 	var err error
@@ -52,7 +79,7 @@ func Open(driver string, url string) *Db {
 	database.Url = url
 	database.conn, err = sql.Open(driver, url)
 	if err != nil {
-		log.Error().Msg(err.Error())
+		database.Logger().Error().Err(err).Str("driver", driver).Msg("open")
 	}
 	return &database
 }
@@ -60,55 +87,185 @@ func Open(driver string, url string) *Db {
 // Close the database connection
 func (db *Db) Close() {
 	db.conn.Close()
+	db.ClearStatements()
+	if db.replicas != nil {
+		db.replicas.close()
+	}
 }
 
 func (db *Db) Table(name string) *TableInfo {
 	var ti TableInfo
 	ti.Name = name
+	ti.Schema = db.schema
 	ti.db = db
 	return &ti
 }
 
+// ColumnNames : Provide the column names in ordinal position, columns of unknown position come last, sorted
+func (t TableInfo) ColumnNames() []string {
+	names := make([]string, 0, len(t.Columns))
+	seen := make(map[string]bool, len(t.Columns))
+	for _, name := range t.order {
+		if _, ok := t.Columns[name]; ok && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+	var others []string
+	for name := range t.Columns {
+		if !seen[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	return append(names, others...)
+}
+
+// MarshalJSON : Write the table description, columns in ordinal position
+func (t TableInfo) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	name, err := json.Marshal(t.Name)
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString(`{"name":`)
+	buf.Write(name)
+	buf.WriteString(`,"columns":{`)
+	for i, column := range t.ColumnNames() {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		key, _ := json.Marshal(column)
+		value, _ := json.Marshal(t.Columns[column])
+		buf.Write(key)
+		buf.WriteString(":")
+		buf.Write(value)
+	}
+	buf.WriteString("}}")
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON : Read a table description, the order of the columns is kept
+func (t *TableInfo) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Name    string          `json:"name"`
+		Columns json.RawMessage `json:"columns"`
+	}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	t.Name = raw.Name
+	t.Columns = nil
+	t.order = nil
+	if len(raw.Columns) == 0 || string(raw.Columns) == "null" {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw.Columns))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		return errors.New("columns: object expected")
+	}
+	t.Columns = make(map[string]string)
+	for dec.More() {
+		tok, err = dec.Token()
+		if err != nil {
+			return err
+		}
+		name := tok.(string)
+		var sqltype string
+		err = dec.Decode(&sqltype)
+		if err != nil {
+			return err
+		}
+		if _, ok := t.Columns[name]; !ok {
+			t.order = append(t.order, name)
+		}
+		t.Columns[name] = sqltype
+	}
+	return nil
+}
+
 // GetAssociativeArray : Provide table data as an associative array
 func (t *TableInfo) GetAssociativeArray(columns []string, restriction string, sortkeys []string, dir string) ([]AssRow, error) {
-	return t.db.QueryAssociativeArray(t.buildSelect("", columns, restriction, sortkeys, dir))
+	view := *t.db
+	view.prepare = true
+	return view.selectRows(t.buildSelect("", columns, restriction, sortkeys, dir))
 }
 
 // QueryAssociativeArray : Provide query result as an associative array
 func (db *Db) QueryAssociativeArray(query string) (Rows, error) {
-	if db.LogQueries {
-		log.Info().Msg(query)
+	res, err := db.QueryOrdered(query)
+	if err != nil {
+		return nil, err
+	}
+	return res.Rows(), nil
+}
+
+// QueryOrdered : Provide query result with its columns in select order
+func (db *Db) QueryOrdered(query string) (*OrderedRows, error) {
+	return db.cachedQuery(query, func() (*OrderedRows, error) {
+		if db.tx == nil && db.schema != "" && db.Driver == "postgres" {
+			// the transaction sets the search_path, for the tables the query leaves unqualified
+			var res *OrderedRows
+			err := db.WithTx(func(tx *Db) error {
+				var err error
+				res, err = tx.queryOrdered(query)
+				return err
+			})
+			return res, err
+		}
+		return db.queryOrdered(query)
+	})
+}
+
+// selectRows : Provide the result of a select built by the package, its tables are qualified
+func (db *Db) selectRows(query string) (Rows, error) {
+	res, err := db.selectOrdered(query)
+	if err != nil {
+		return nil, err
 	}
-	rows, err := db.conn.Query(query)
+	return res.Rows(), nil
+}
+
+// readRows : Provide the result of a select built by the package around the result cache,
+// for values no write of a table invalidates, as sequences
+func (db *Db) readRows(query string) (Rows, error) {
+	res, err := db.queryOrdered(query)
 	if err != nil {
-		log.Error().Msg(err.Error())
-		log.Error().Msg(query)
 		return nil, err
 	}
-	defer rows.Close()
-	// get rows
-	results := Rows{}
-	cols, err := rows.Columns()
+	return res.Rows(), nil
+}
+
+// selectOrdered : QueryOrdered for a select built by the package, which needs no search_path
+func (db *Db) selectOrdered(query string) (*OrderedRows, error) {
+	return db.cachedQuery(query, func() (*OrderedRows, error) {
+		return db.queryOrdered(query)
+	})
+}
+
+func (db *Db) queryOrdered(query string) (*OrderedRows, error) {
+	rows, err := db.readQuery(query)
 	if err != nil {
-		log.Error().Msg(err.Error())
-		log.Error().Msg(query)
 		return nil, err
 	}
-	// make types map
+	defer rows.Close()
+	// make columns description
 	columnTypes, err := rows.ColumnTypes()
 	if err != nil {
 		return nil, err
 	}
-	columnType := make(map[string]string)
-	for _, colType := range columnTypes {
-		columnType[colType.Name()] = colType.DatabaseTypeName()
-	}
+	results := newOrderedRows(columnTypes)
 
 	for rows.Next() {
 		// Create a slice of interface{}'s to represent each column,
 		// and a second slice to contain pointers to each item in the columns slice.
-		columns := make([]interface{}, len(cols))
-		columnPointers := make([]interface{}, len(cols))
+		columns := make([]interface{}, len(columnTypes))
+		columnPointers := make([]interface{}, len(columnTypes))
 		for i := range columns {
 			columnPointers[i] = &columns[i]
 		}
@@ -119,77 +276,34 @@ func (db *Db) QueryAssociativeArray(query string) (Rows, error) {
 			return nil, err
 		}
 
-		// Create our map, and retrieve the value for each column from the pointers slice,
-		// storing it in the map with the name of the column as the key.
-		m := make(AssRow)
-		for i, colName := range cols {
-			//fmt.Println(colName)
-			val := columnPointers[i].(*interface{})
-			if db.Driver == "mysql" {
-				if (*val) == nil {
-					m[colName] = nil
-				} else {
-					switch columnType[colName] {
-					case "INT", "BIGINT":
-						i, err := strconv.ParseInt(fmt.Sprintf("%s", *val), 10, 64)
-						if err != nil {
-							return nil, err
-						}
-						m[colName] = i
-					case "UNSIGNED BIGINT", "UNSIGNED INT":
-						u, err := strconv.ParseUint(fmt.Sprintf("%s", *val), 10, 64)
-						if err != nil {
-							return nil, err
-						}
-						m[colName] = u
-					case "FLOAT":
-						f, err := strconv.ParseFloat(fmt.Sprintf("%s", *val), 64)
-						if err != nil {
-							return nil, err
-						}
-						m[colName] = f
-					case "TINYINT":
-						i, err := strconv.ParseInt(fmt.Sprintf("%s", *val), 10, 64)
-						if err != nil {
-							return nil, err
-						}
-						if i == 1 {
-							m[colName] = true
-						} else {
-							m[colName] = false
-						}
-
-					case "VARCHAR", "TEXT", "TIMESTAMP", "VARBINARY":
-						m[colName] = fmt.Sprintf("%s", *val)
-					default:
-						if reflect.ValueOf(val).IsNil() {
-							m[colName] = nil
-						} else {
-							fmt.Printf("Unknow type : %s (%s)\n", columnType[colName], query)
-							m[colName] = fmt.Sprintf("%v", *val)
-						}
-					}
-				}
-			}
-			if db.Driver == "postgres" || db.Driver == "sqlserver" {
-				m[colName] = *val
+		// Convert each value according to its column type
+		for i, column := range results.Columns {
+			columns[i], err = db.convertValue(column.DatabaseType, columns[i])
+			if err != nil {
+				err = fmt.Errorf("column %s (%s): %w", column.Name, column.DatabaseType, err)
+				return nil, err
 			}
 		}
-		results = append(results, m)
+		results.Values = append(results.Values, columns)
 	}
-	return results, nil
+	return results, rows.Err()
 }
 
 // GetSchema : Provide table schema as an associative array
 func (t *TableInfo) GetSchema() (*TableInfo, error) {
-	pgSchema := "SELECT column_name :: varchar as name, REPLACE(REPLACE(data_type,'character varying','varchar'),'character','char') || COALESCE('(' || character_maximum_length || ')', '') as type, col_description('public." + t.Name + "'::regclass, ordinal_position) as comment  from INFORMATION_SCHEMA.COLUMNS where table_name ='" + t.Name + "';"
-	mySchema := "SELECT COLUMN_NAME as name, CONCAT(DATA_TYPE, COALESCE(CONCAT('(' , CHARACTER_MAXIMUM_LENGTH, ')'), '')) as type FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_NAME = '" + t.Name + "';"
+	if ti, ok := t.cachedSchema(); ok {
+		return ti, nil
+	}
+	pgSchema := "SELECT column_name :: varchar as name, REPLACE(REPLACE(data_type,'character varying','varchar'),'character','char') || COALESCE('(' || character_maximum_length || ')', '') as type, col_description((quote_ident(table_schema) || '.' || quote_ident(table_name))::regclass, ordinal_position) as comment  from INFORMATION_SCHEMA.COLUMNS where table_name ='" + t.Name + "' AND " + t.db.schemaFilter("table_schema", t.schemaName()) + " ORDER BY ordinal_position;"
+	// tinyint(1) is the way mysql declares booleans
+	mySchema := "SELECT COLUMN_NAME as name, CASE WHEN DATA_TYPE = 'tinyint' THEN COLUMN_TYPE ELSE CONCAT(DATA_TYPE, COALESCE(CONCAT('(' , CHARACTER_MAXIMUM_LENGTH, ')'), '')) END as type FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_NAME = '" + t.Name + "' AND " + t.db.schemaFilter("TABLE_SCHEMA", t.schemaName()) + " ORDER BY ORDINAL_POSITION;"
 	// nob
-	msSchema := "SELECT COLUMN_NAME as name, CONCAT(DATA_TYPE, COALESCE(CONCAT('(' , CHARACTER_MAXIMUM_LENGTH, ')'), '')) as type FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_NAME = '" + t.Name + "';"
+	msSchema := "SELECT COLUMN_NAME as name, CONCAT(DATA_TYPE, COALESCE(CONCAT('(' , CHARACTER_MAXIMUM_LENGTH, ')'), '')) as type FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_NAME = '" + t.Name + "' AND " + t.db.schemaFilter("TABLE_SCHEMA", t.schemaName()) + " ORDER BY ORDINAL_POSITION;"
 
 	var schemaQuery string
 	var ti TableInfo
 	ti.Name = t.Name
+	ti.Schema = t.schemaName()
 	ti.db = t.db
 	if t.db.Driver == "postgres" {
 		schemaQuery = pgSchema
@@ -201,9 +315,8 @@ func (t *TableInfo) GetSchema() (*TableInfo, error) {
 	if t.db.Driver == "sqlserver" {
 		schemaQuery = msSchema
 	}
-	cols, err := t.db.QueryAssociativeArray(schemaQuery)
+	cols, err := t.db.selectRows(schemaQuery)
 	if err != nil {
-		log.Error().Msg(err.Error())
 		return nil, err
 	}
 	ti.Columns = make(map[string]string)
@@ -221,10 +334,15 @@ func (t *TableInfo) GetSchema() (*TableInfo, error) {
 			}
 		}
 		ti.Columns[name] = rowtype
+		ti.order = append(ti.order, name)
 		if comment != "<nil>" && strings.TrimSpace(comment) != "" {
 			ti.Columns[name] = ti.Columns[name] + "|" + comment
 		}
 	}
+	// a description read in a transaction may be rolled back
+	if t.db.schemas != nil && t.db.tx == nil && len(ti.Columns) > 0 {
+		t.db.schemas.set(&ti)
+	}
 	return &ti, nil
 }
 
@@ -233,7 +351,6 @@ func (db *Db) GetSchema() ([]TableInfo, error) {
 	var res []TableInfo
 	tables, err := db.ListTables()
 	if err != nil {
-		log.Error().Msg(err.Error())
 		return nil, err
 	}
 	for _, row := range tables {
@@ -241,10 +358,10 @@ func (db *Db) GetSchema() ([]TableInfo, error) {
 			var ti TableInfo
 			var fullti *TableInfo
 			ti.Name = fmt.Sprintf("%v", element)
+			ti.Schema = db.schema
 			ti.db = db
 			fullti, err = ti.GetSchema()
 			if err != nil {
-				log.Error().Msg(err.Error())
 				return nil, err
 			}
 			res = append(res, *fullti)
@@ -269,37 +386,51 @@ func (db *Db) ListTables() (Rows, error) {
 }
 
 func (db *Db) pgListTables() (Rows, error) {
-	return db.QueryAssociativeArray("SELECT table_name :: varchar as name FROM information_schema.tables WHERE table_schema = 'public' ORDER BY table_name;")
+	return db.selectRows("SELECT table_name :: varchar as name FROM information_schema.tables WHERE " + db.schemaFilter("table_schema", db.schema) + " ORDER BY table_name;")
 }
 
 func (db *Db) myListTables() (Rows, error) {
-	return db.QueryAssociativeArray("SELECT TABLE_NAME as name FROM information_schema.TABLES WHERE TABLE_TYPE LIKE 'BASE_TABLE';")
+	return db.selectRows("SELECT TABLE_NAME as name FROM information_schema.TABLES WHERE TABLE_TYPE LIKE 'BASE_TABLE' AND " + db.schemaFilter("TABLE_SCHEMA", db.schema) + ";")
 }
 
 // nob identical request
 func (db *Db) msListTables() (Rows, error) {
-	return db.QueryAssociativeArray("SELECT TABLE_NAME as name FROM information_schema.TABLES WHERE TABLE_TYPE LIKE 'BASE_TABLE';")
+	return db.selectRows("SELECT TABLE_NAME as name FROM information_schema.TABLES WHERE TABLE_TYPE LIKE 'BASE_TABLE' AND " + db.schemaFilter("TABLE_SCHEMA", db.schema) + ";")
 }
 
 func (db *Db) CreateTable(t TableInfo) error {
+	if t.Schema == "" {
+		t.Schema = db.schema
+	}
 	if db.Driver == "postgres" {
 		return db.pgCreateTable(t)
 	}
 	if db.Driver == "mysql" {
 		return db.myCreateTable(t)
 	}
-	// nob requête identique
 	if db.Driver == "sqlserver" {
-		return db.myCreateTable(t)
+		return db.msCreateTable(t)
 	}
 	return errors.New("no driver")
 }
 
 func (db *Db) pgCreateTable(t TableInfo) error {
 	t.db = db
-	query := "create table " + t.Name + " ( "
+	for _, query := range pgCreateTableQueries(t) {
+		_, err := t.db.exec(t.db.session(), query)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pgCreateTableQueries : build the create table statement followed by the column comments
+func pgCreateTableQueries(t TableInfo) []string {
+	query := "create table " + t.qualifiedName() + " ( "
 	columns := ""
-	for name, rowtype := range t.Columns {
+	for _, name := range t.ColumnNames() {
+		rowtype := t.Columns[name]
 		if fmt.Sprintf("%v", name) == "id" {
 			columns += fmt.Sprintf("%v", name) + " " + "SERIAL PRIMARY KEY,"
 		} else {
@@ -310,37 +441,42 @@ func (db *Db) pgCreateTable(t TableInfo) error {
 	}
 	query += columns
 	query = query[:len(query)-1] + " )"
-	if db.LogQueries {
-		log.Info().Msg(query)
+	queries := []string{query}
+	for _, name := range t.ColumnNames() {
+		desc := strings.Split(fmt.Sprintf("%v", t.Columns[name]), "|")
+		if len(desc) > 1 {
+			queries = append(queries, "COMMENT ON COLUMN "+t.qualifiedName()+"."+fmt.Sprintf("%v", name)+" IS '"+desc[1]+"'")
+		}
 	}
-	_, err := t.db.conn.Query(query)
+	return queries
+}
+
+func (db *Db) myCreateTable(t TableInfo) error {
+	t.db = db
+	query := myCreateTableQuery(t)
+	_, err := t.db.exec(t.db.session(), query)
 	if err != nil {
-		log.Error().Msg(err.Error())
 		return err
 	}
-	for name, rowtype := range t.Columns {
-		desc := strings.Split(fmt.Sprintf("%v", rowtype), "|")
-		if len(desc) > 1 {
-			query = "COMMENT ON COLUMN " + t.Name + "." + fmt.Sprintf("%v", name) + " IS '" + desc[1] + "'"
-			if db.LogQueries {
-				log.Info().Msg(query)
-			}
-			_, err := t.db.conn.Query(query)
-			if err != nil {
-				log.Error().Msg(err.Error())
-				return err
-			}
-		}
+	return nil
+}
 
+func (db *Db) msCreateTable(t TableInfo) error {
+	t.db = db
+	query := msCreateTableQuery(t)
+	_, err := t.db.exec(t.db.session(), query)
+	if err != nil {
+		return err
 	}
 	return nil
 }
 
-func (db *Db) myCreateTable(t TableInfo) error {
-	t.db = db
-	query := "create table " + t.Name + " ( "
+// myCreateTableQuery : build the create table statement, comments included
+func myCreateTableQuery(t TableInfo) string {
+	query := "create table " + t.qualifiedName() + " ( "
 	columns := ""
-	for name, rowtype := range t.Columns {
+	for _, name := range t.ColumnNames() {
+		rowtype := t.Columns[name]
 		if fmt.Sprintf("%v", name) == "id" {
 			columns += fmt.Sprintf("%v", name) + " " + "SERIAL PRIMARY KEY,"
 		} else {
@@ -353,35 +489,49 @@ func (db *Db) myCreateTable(t TableInfo) error {
 		}
 	}
 	query += columns
-	query = query[:len(query)-1] + " )"
-	if db.LogQueries {
-		log.Info().Msg(query)
+	return query[:len(query)-1] + " )"
+}
+
+// msCreateTableQuery : build the create table statement, id is an identity column
+func msCreateTableQuery(t TableInfo) string {
+	query := "create table " + t.qualifiedName() + " ( "
+	columns := ""
+	for _, name := range t.ColumnNames() {
+		rowtype := t.Columns[name]
+		if name == "id" {
+			columns += name + " INT IDENTITY(1,1) PRIMARY KEY,"
+		} else {
+			desc := strings.Split(rowtype, "|")
+			columns += name + " " + desc[0] + ","
+		}
 	}
-	_, err := t.db.conn.Query(query)
-	if err != nil {
-		log.Error().Msg(err.Error())
-		return err
+	query += columns
+	return query[:len(query)-1] + " )"
+}
+
+// createTableQueries : statements CreateTable would run for the current driver
+func (db *Db) createTableQueries(t TableInfo) ([]string, error) {
+	if db.Driver == "postgres" {
+		return pgCreateTableQueries(t), nil
 	}
-	return nil
+	if db.Driver == "mysql" {
+		return []string{myCreateTableQuery(t)}, nil
+	}
+	if db.Driver == "sqlserver" {
+		return []string{msCreateTableQuery(t)}, nil
+	}
+	return nil, errors.New("no driver")
 }
 
 func (t *TableInfo) DeleteTable() error {
-	query := "drop table " + t.Name
-	if t.db.LogQueries {
-		log.Info().Msg(query)
-	}
-	_, err := t.db.conn.Query(query)
+	query := "drop table " + t.qualifiedName()
+	_, err := t.db.exec(t.db.session(), query)
 	if err != nil {
-		log.Error().Msg(err.Error())
 		return err
 	}
-	query = "drop sequence if exists sq_" + t.Name
-	if t.db.LogQueries {
-		log.Info().Msg(query)
-	}
-	_, err = t.db.conn.Query(query)
+	query = "drop sequence if exists " + qualify(t.schemaName(), "sq_"+t.Name)
+	_, err = t.db.exec(t.db.session(), query)
 	if err != nil {
-		log.Error().Msg(err.Error())
 		return err
 	}
 	return nil
@@ -398,58 +548,39 @@ func (t *TableInfo) AddColumn(name string, sqltype string, comment string) error
 }
 
 func (t *TableInfo) pgAddColumn(name string, sqltype string, comment string) error {
-	query := "alter table " + t.Name + " add " + name + " " + sqltype
-	if t.db.LogQueries {
-		log.Info().Msg(query)
-	}
-	rows, err := t.db.conn.Query(query)
+	query := "alter table " + t.qualifiedName() + " add " + name + " " + sqltype
+	_, err := t.db.exec(t.db.session(), query)
 	if err != nil {
-		log.Error().Msg(err.Error())
 		return err
 	}
 	if strings.TrimSpace(comment) != "" {
-		query = "COMMENT ON COLUMN " + t.Name + "." + name + " IS '" + comment + "'"
-		if t.db.LogQueries {
-			log.Info().Msg(query)
-		}
-		_, err = t.db.conn.Query(query)
+		query = "COMMENT ON COLUMN " + t.qualifiedName() + "." + name + " IS '" + comment + "'"
+		_, err = t.db.exec(t.db.session(), query)
 		if err != nil {
-			log.Error().Msg(err.Error())
 			return err
 		}
 	}
-	defer rows.Close()
 	return nil
 }
 
 func (t *TableInfo) myAddColumn(name string, sqltype string, comment string) error {
-	query := "alter table " + t.Name + " add " + name + " " + sqltype
+	query := "alter table " + t.qualifiedName() + " add " + name + " " + sqltype
 	if strings.TrimSpace(comment) != "" {
 		query += " COMMENT " + pq.QuoteLiteral(comment)
 	}
-	if t.db.LogQueries {
-		log.Info().Msg(query)
-	}
-	rows, err := t.db.conn.Query(query)
+	_, err := t.db.exec(t.db.session(), query)
 	if err != nil {
-		log.Error().Msg(err.Error())
 		return err
 	}
-	defer rows.Close()
 	return nil
 }
 
 func (t *TableInfo) DeleteColumn(name string) error {
-	query := "alter table " + t.Name + " drop " + name
-	if t.db.LogQueries {
-		log.Info().Msg(query)
-	}
-	rows, err := t.db.conn.Query(query)
+	query := "alter table " + t.qualifiedName() + " drop " + name
+	_, err := t.db.exec(t.db.session(), query)
 	if err != nil {
-		log.Error().Msg(err.Error())
 		return err
 	}
-	defer rows.Close()
 	return nil
 }
 
@@ -459,13 +590,13 @@ func (db *Db) ImportSchema(filename string) {
 	var jsonSource []TableInfo
 	err := json.Unmarshal([]byte(byteValue), &jsonSource)
 	if err != nil {
-		log.Error().Msg(err.Error())
+		db.Logger().Error().Err(err).Str("file", filename).Msg("import schema")
 	}
 	for _, ti := range jsonSource {
 		ti.db = db
 		err = db.CreateTable(ti)
 		if err != nil {
-			log.Error().Msg(err.Error())
+			db.Logger().Error().Err(err).Str("table", ti.Name).Msg("import schema")
 		}
 	}
 }
@@ -479,20 +610,20 @@ func (db *Db) ClearImportSchema(filename string) {
 		ti.db = db
 		err := ti.DeleteTable()
 		if err != nil {
-			log.Error().Msg(err.Error())
+			db.Logger().Error().Err(err).Str("table", ti.Name).Msg("clear import schema")
 		}
 	}
 }
 
 func (db *Db) ListSequences() (Rows, error) {
-	return db.QueryAssociativeArray("SELECT sequence_name :: varchar FROM information_schema.sequences WHERE sequence_schema = 'public' ORDER BY sequence_name;")
+	return db.selectRows("SELECT sequence_name :: varchar FROM information_schema.sequences WHERE " + db.schemaFilter("sequence_schema", db.schema) + " ORDER BY sequence_name;")
 }
 
 func (t *TableInfo) buildSelect(key string, columns []string, restriction string, sortkeys []string, dir ...string) string {
 	if key != "" {
 		columns = append(columns, key)
 	}
-	query := "select " + strings.Join(columns, ",") + " from " + t.Name
+	query := "select " + strings.Join(columns, ",") + " from " + t.qualifiedName()
 	if restriction != "" {
 		query += " where " + restriction
 	}
@@ -506,13 +637,18 @@ func (t *TableInfo) buildSelect(key string, columns []string, restriction string
 }
 
 func (t *TableInfo) Insert(record AssRow) (int64, error) {
+	if len(record) == 0 {
+		return -1, errors.New("insert: empty record")
+	}
 	columns := ""
 	values := ""
 	t, err := t.GetSchema()
 	if err != nil {
-		log.Error().Msg(err.Error())
 		return -1, err
 	}
+	if t.db.statements != nil {
+		return t.preparedInsert(record)
+	}
 	var id int64
 
 	for key, element := range record {
@@ -520,11 +656,8 @@ func (t *TableInfo) Insert(record AssRow) (int64, error) {
 		values += FormatForSQL(t.Columns[key], element) + ","
 	}
 	if t.db.Driver == "postgres" {
-		query := "INSERT INTO " + t.Name + "(" + removeLastChar(columns) + ") VALUES (" + removeLastChar(values) + ") RETURNING id"
-		if t.db.LogQueries {
-			log.Info().Msg(query)
-		}
-		err = t.db.conn.QueryRow(query).Scan(&id)
+		query := "INSERT INTO " + t.qualifiedName() + "(" + removeLastChar(columns) + ") VALUES (" + removeLastChar(values) + ") RETURNING id"
+		err = t.db.queryRow(t.db.session(), query, nil, &id)
 	}
 	if t.db.Driver == "mysql" {
 		/*		_, err = t.db.conn.Query("INSERT INTO " + t.Name + "(" + removeLastChar(columns) + ") VALUES (" + removeLastChar(values) + ")")
@@ -533,16 +666,8 @@ func (t *TableInfo) Insert(record AssRow) (int64, error) {
 				}
 				err = t.db.conn.QueryRow("SELECT LAST_INSERT_ID()").Scan(&id)*/
 
-		query := "INSERT INTO " + t.Name + "(" + removeLastChar(columns) + ") VALUES (" + removeLastChar(values) + ")"
-		stmt, err := t.db.conn.Prepare(query)
-		if t.db.LogQueries {
-			log.Info().Msg(query)
-		}
-		fmt.Println("INSERT INTO " + t.Name + "(" + removeLastChar(columns) + ") VALUES (" + removeLastChar(values) + ")")
-		if err != nil {
-			return id, err
-		}
-		res, err := stmt.Exec()
+		query := "INSERT INTO " + t.qualifiedName() + "(" + removeLastChar(columns) + ") VALUES (" + removeLastChar(values) + ")"
+		res, err := t.db.exec(t.db.session(), query)
 		if err != nil {
 			return id, err
 		}
@@ -555,12 +680,17 @@ func (t *TableInfo) Insert(record AssRow) (int64, error) {
 }
 
 func (t *TableInfo) Update(record AssRow) error {
+	if _, ok := record["id"]; len(record) == 0 || (ok && len(record) == 1) {
+		return errors.New("update: no column to set")
+	}
 
 	t, err := t.GetSchema()
 	if err != nil {
-		log.Error().Msg(err.Error())
 		return err
 	}
+	if t.db.statements != nil {
+		return t.preparedUpdate(record)
+	}
 	id := ""
 	stack := ""
 
@@ -574,21 +704,18 @@ func (t *TableInfo) Update(record AssRow) error {
 
 	}
 	stack = removeLastChar(stack)
-	query := ("UPDATE " + t.Name + " SET " + stack + " WHERE id = " + id)
-	if t.db.LogQueries {
-		log.Info().Msg(query)
-	}
-	rows, err := t.db.conn.Query(query)
+	query := ("UPDATE " + t.qualifiedName() + " SET " + stack + " WHERE id = " + id)
+	_, err = t.db.exec(t.db.session(), query)
 	if err != nil {
-		log.Error().Msg(query)
-		log.Error().Msg(err.Error())
 		return err
 	}
-	defer rows.Close()
 	return nil
 }
 
 func (t *TableInfo) Delete(record AssRow) error {
+	if t.db.statements != nil {
+		return t.preparedDelete(record)
+	}
 	id := ""
 	values := ""
 
@@ -599,32 +726,20 @@ func (t *TableInfo) Delete(record AssRow) error {
 			break
 		}
 	}
-	query := ("DELETE FROM " + t.Name + " WHERE id = " + id)
-	if t.db.LogQueries {
-		log.Info().Msg(query)
-	}
-	rows, err := t.db.conn.Query(query)
+	query := ("DELETE FROM " + t.qualifiedName() + " WHERE id = " + id)
+	_, err := t.db.exec(t.db.session(), query)
 	if err != nil {
-		log.Error().Msg(query)
-		log.Error().Msg(err.Error())
 		return err
 	}
-	defer rows.Close()
 	return nil
 }
 
 func (t *TableInfo) WildDelete(restriction string) error {
-	query := ("DELETE FROM " + t.Name + " WHERE " + restriction)
-	if t.db.LogQueries {
-		log.Info().Msg(query)
-	}
-	rows, err := t.db.conn.Query(query)
+	query := ("DELETE FROM " + t.qualifiedName() + " WHERE " + restriction)
+	_, err := t.db.exec(t.db.session(), query)
 	if err != nil {
-		log.Error().Msg(query)
-		log.Error().Msg(err.Error())
 		return err
 	}
-	defer rows.Close()
 	return nil
 }
 
@@ -652,19 +767,17 @@ func removeLastChar(s string) string {
 }
 
 func (ar *AssRow) GetString(column string) string {
-	str := fmt.Sprintf("%v", (*ar)[column])
+	str, _ := ar.Strict().String(column)
 	return str
 }
 
 func (ar *AssRow) GetInt(column string) int {
-	str := fmt.Sprintf("%v", (*ar)[column])
-	val, _ := strconv.Atoi(str)
-	return val
+	val, _ := ar.Strict().Int64(column)
+	return int(val)
 }
 
 func (ar *AssRow) GetFloat(column string) float64 {
-	str := fmt.Sprintf("%v", (*ar)[column])
-	val, _ := strconv.ParseFloat(str, 64)
+	val, _ := ar.Strict().Float64(column)
 	return val
 }
 
@@ -675,7 +788,6 @@ func Quote(str string) string {
 func (db *Db) SaveSchema(generatedFilename string) error {
 	schema, err := db.GetSchema()
 	if err != nil {
-		log.Error().Msg(err.Error())
 		return err
 	}
 	//	file, _ := json.Marshal(schema)
@@ -687,14 +799,15 @@ func (db *Db) SaveSchema(generatedFilename string) error {
 func buildLinks(schema []TableInfo) []Link {
 	var links []Link
 	for _, ti := range schema {
-		fmt.Println(ti.Name)
-		for column, _ := range ti.Columns {
+		for _, column := range ti.ColumnNames() {
 			if strings.HasSuffix(column, "_id") {
 				tokens := strings.Split(column, "_")
 				linkedtable := tokens[len(tokens)-2]
 				var link Link
 				link.Source = ti.Name
 				link.Destination = linkedtable
+				link.SourceColumn = column
+				link.DestinationColumn = "id"
 				links = append(links, link)
 			}
 		}
@@ -704,70 +817,31 @@ func buildLinks(schema []TableInfo) []Link {
 
 // Generate templates from a schema
 func (db *Db) GenerateSchemaTemplate(templateFilename string, generatedFilename string) error {
-	schema, err := db.GetSchema()
+	// a template failing to parse leaves the previous output untouched
+	t, data, err := db.schemaTemplate(templateFilename, TemplateOptions{})
 	if err != nil {
-		log.Error().Msg(err.Error())
-		return err
-	}
-	links := buildLinks(schema)
-	data := struct {
-		Tbl []TableInfo
-		Lnk []Link
-	}{
-		schema,
-		links,
-	}
-
-	t, err := template.ParseFiles(templateFilename)
-	if err != nil {
-		log.Error().Msg(err.Error())
 		return err
 	}
 	f, err := os.Create(generatedFilename)
 	if err != nil {
-		log.Error().Msg("create file: " + err.Error())
-		return err
-	}
-	err = t.Execute(f, data)
-	if err != nil {
-		log.Error().Msg(err.Error())
 		return err
 	}
-	return nil
+	defer f.Close()
+	return t.Execute(f, data)
 }
 
 // Generate tables
 func (db *Db) GenerateTableTemplates(templateFilename string, outputFolder string, extension string) error {
-	schema, err := db.GetSchema()
-	if err != nil {
-		log.Error().Msg(err.Error())
-		return err
-	}
-	for _, ti := range schema {
-
-		t, err := template.ParseFiles(templateFilename)
-		if err != nil {
-			log.Error().Msg(err.Error())
-			return err
-		}
-		f, err := os.Create(outputFolder + string(os.PathSeparator) + ti.Name + "." + extension)
-		if err != nil {
-			log.Error().Msg("create file: " + err.Error())
-			return err
-		}
-		err = t.Execute(f, ti)
-		if err != nil {
-			log.Error().Msg(err.Error())
-			return err
-		}
-	}
-	return nil
+	return db.ExecuteTableTemplates(OutputDir(outputFolder), templateFilename, extension, TemplateOptions{})
 }
 
 func FormatForSQL(datatype string, value interface{}) string {
 	if value == nil {
 		return "NULL"
 	}
+	if b, ok := value.([]byte); ok && !strings.Contains(datatype, "char") && !strings.Contains(datatype, "text") {
+		return binaryLiteral(datatype, b)
+	}
 	strval := fmt.Sprintf("%v", value)
 	if !strings.Contains(datatype, "char") && len(strval) == 0 {
 		return "NULL"
@@ -778,11 +852,25 @@ func FormatForSQL(datatype string, value interface{}) string {
 	return fmt.Sprint(strval)
 }
 
+// binaryLiteral : hexadecimal literal of bytes, a bytea escape for postgres and 0x for mysql and sqlserver, NULL when empty
+func binaryLiteral(datatype string, b []byte) string {
+	if len(b) == 0 {
+		return "NULL"
+	}
+	if strings.Contains(datatype, "bytea") {
+		return `'\x` + hex.EncodeToString(b) + "'"
+	}
+	return "0x" + hex.EncodeToString(b)
+}
+
 // Build a map based on id from a query result
 func (db *Db) BuildIdMap(idxkey string, rows Rows) (map[int64]AssRow, error) {
 	ht := make(map[int64]AssRow)
 	for _, row := range rows {
-		id := row[idxkey].(int64)
+		id, ok := NormalizeKey(row[idxkey]).(int64)
+		if !ok {
+			return nil, fmt.Errorf("%s: %v is not an integer key", idxkey, row[idxkey])
+		}
 		ht[id] = row
 	}
 	return ht, nil
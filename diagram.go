@@ -0,0 +1,175 @@
+package sqldb
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// DiagramOptions : restrict an entity relationship diagram
+type DiagramOptions struct {
+	Tables []string // tables to draw, the whole schema when empty
+	Depth  int      // hops of linked tables drawn around Tables
+}
+
+// diagram : tables, links and nullability an ER diagram is drawn from
+type diagram struct {
+	tables   []TableInfo
+	links    []Link
+	nullable map[string]map[string]bool
+}
+
+// buildDiagram : read the schema and keep the requested tables and their neighbours
+func (db *Db) buildDiagram(opts DiagramOptions) (*diagram, error) {
+	schema, err := db.GetSchema()
+	if err != nil {
+		return nil, err
+	}
+	links, err := db.schemaLinks(schema)
+	if err != nil {
+		return nil, err
+	}
+	nullable, err := db.nullableColumns()
+	if err != nil {
+		return nil, err
+	}
+	d := &diagram{tables: schema, links: links, nullable: nullable}
+	if len(opts.Tables) == 0 {
+		return d, nil
+	}
+	keep := make(map[string]bool)
+	for _, name := range opts.Tables {
+		keep[name] = true
+	}
+	for hop := 0; hop < opts.Depth; hop++ {
+		next := make(map[string]bool)
+		for _, link := range links {
+			if keep[link.Source] {
+				next[link.Destination] = true
+			}
+			if keep[link.Destination] {
+				next[link.Source] = true
+			}
+		}
+		for name := range next {
+			keep[name] = true
+		}
+	}
+	d.tables = nil
+	for _, ti := range schema {
+		if keep[ti.Name] {
+			d.tables = append(d.tables, ti)
+		}
+	}
+	d.links = nil
+	for _, link := range links {
+		if keep[link.Source] && keep[link.Destination] {
+			d.links = append(d.links, link)
+		}
+	}
+	return d, nil
+}
+
+// foreignColumns : columns of a table referencing another table
+func (d *diagram) foreignColumns(table string) map[string]bool {
+	columns := make(map[string]bool)
+	for _, link := range d.links {
+		if link.Source == table {
+			columns[link.SourceColumn] = true
+		}
+	}
+	return columns
+}
+
+// GenerateMermaid : Write the schema as a Mermaid erDiagram
+func (db *Db) GenerateMermaid(w io.Writer, opts DiagramOptions) error {
+	d, err := db.buildDiagram(opts)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString("erDiagram\n")
+	for _, ti := range d.tables {
+		fks := d.foreignColumns(ti.Name)
+		fmt.Fprintf(bw, "    %s {\n", ti.Name)
+		for _, name := range ti.ColumnNames() {
+			desc := strings.SplitN(ti.Columns[name], "|", 2)
+			sqltype := strings.NewReplacer(" ", "_", ",", "_").Replace(desc[0])
+			keys := []string{}
+			if name == "id" {
+				keys = append(keys, "PK")
+			}
+			if fks[name] {
+				keys = append(keys, "FK")
+			}
+			comment := "not null"
+			if d.nullable[ti.Name][name] {
+				comment = "null"
+			}
+			if len(desc) > 1 {
+				comment += ", " + desc[1]
+			}
+			attribute := []string{sqltype, name}
+			if len(keys) > 0 {
+				attribute = append(attribute, strings.Join(keys, ","))
+			}
+			attribute = append(attribute, fmt.Sprintf("%q", strings.ReplaceAll(comment, `"`, "'")))
+			fmt.Fprintf(bw, "        %s\n", strings.Join(attribute, " "))
+		}
+		bw.WriteString("    }\n")
+	}
+	for _, link := range d.links {
+		// a row of the source table references zero or one row when the column is nullable
+		parent := "||"
+		if d.nullable[link.Source][link.SourceColumn] {
+			parent = "|o"
+		}
+		fmt.Fprintf(bw, "    %s %s--o{ %s : %q\n", link.Destination, parent, link.Source, link.SourceColumn)
+	}
+	return bw.Flush()
+}
+
+// GenerateGraphviz : Write the schema as a Graphviz DOT digraph
+func (db *Db) GenerateGraphviz(w io.Writer, opts DiagramOptions) error {
+	d, err := db.buildDiagram(opts)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString("digraph schema {\n")
+	bw.WriteString("    rankdir=LR;\n")
+	bw.WriteString("    node [shape=plaintext fontname=\"Helvetica\"];\n")
+	bw.WriteString("    edge [dir=both arrowtail=crowodot];\n")
+	for _, ti := range d.tables {
+		fks := d.foreignColumns(ti.Name)
+		fmt.Fprintf(bw, "    %q [label=<<table border=\"0\" cellborder=\"1\" cellspacing=\"0\">", ti.Name)
+		fmt.Fprintf(bw, "<tr><td bgcolor=\"lightgrey\" colspan=\"3\"><b>%s</b></td></tr>", html.EscapeString(ti.Name))
+		for _, name := range ti.ColumnNames() {
+			label := html.EscapeString(name)
+			if name == "id" {
+				label = "<u>" + label + "</u>"
+			}
+			if fks[name] {
+				label = "<i>" + label + "</i>"
+			}
+			null := "NOT NULL"
+			if d.nullable[ti.Name][name] {
+				null = "NULL"
+			}
+			desc := strings.SplitN(ti.Columns[name], "|", 2)
+			fmt.Fprintf(bw, "<tr><td port=%q align=\"left\">%s</td><td align=\"left\">%s</td><td align=\"left\">%s</td></tr>", name, label, html.EscapeString(desc[0]), null)
+		}
+		bw.WriteString("</table>>];\n")
+	}
+	for _, link := range d.links {
+		head := "teetee"
+		if d.nullable[link.Source][link.SourceColumn] {
+			head = "teeodot"
+		}
+		fmt.Fprintf(bw, "    %q:%q -> %q:%q [arrowhead=%s label=%q];\n", link.Source, link.SourceColumn, link.Destination, link.DestinationColumn, head, link.SourceColumn)
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
@@ -0,0 +1,348 @@
+package sqldb
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DumpOptions : tune the content of a SQL dump
+type DumpOptions struct {
+	Tables     []string // tables to dump, every table when empty
+	SchemaOnly bool     // only dump the table definitions
+	DataOnly   bool     // only dump the rows and sequence values
+	DropTables bool     // drop the tables before creating them
+	BatchSize  int      // rows per INSERT statement, one row when not set
+}
+
+// Dump : Write the database content as a SQL script replayable with Restore
+func (db *Db) Dump(w io.Writer, opts DumpOptions) error {
+	if opts.SchemaOnly && opts.DataOnly {
+		return errors.New("dump: SchemaOnly and DataOnly are exclusive")
+	}
+	schema, err := db.dumpSchema(opts.Tables)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "-- sqldb dump (%s) %s\n", db.Driver, time.Now().Format(time.RFC3339))
+	for _, ti := range schema {
+		fmt.Fprintf(bw, "\n-- table %s\n", ti.Name)
+		if !opts.DataOnly {
+			if opts.DropTables {
+				fmt.Fprintf(bw, "DROP TABLE IF EXISTS %s;\n", ti.qualifiedName())
+			}
+			queries, err := db.createTableQueries(ti)
+			if err != nil {
+				return err
+			}
+			for _, query := range queries {
+				fmt.Fprintf(bw, "%s;\n", query)
+			}
+		}
+		if !opts.SchemaOnly {
+			err = db.dumpTableData(bw, ti, opts.BatchSize)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// dumpSchema : schema of the requested tables, the whole database when none are given
+func (db *Db) dumpSchema(tables []string) ([]TableInfo, error) {
+	if len(tables) == 0 {
+		return db.GetSchema()
+	}
+	var res []TableInfo
+	for _, name := range tables {
+		ti, err := db.Table(name).GetSchema()
+		if err != nil {
+			return nil, err
+		}
+		if len(ti.Columns) == 0 {
+			return nil, errors.New("dump: unknown table " + name)
+		}
+		res = append(res, *ti)
+	}
+	return res, nil
+}
+
+func (db *Db) dumpTableData(w io.Writer, ti TableInfo, batchSize int) error {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	// sqlserver refuses more than 1000 rows in a VALUES list
+	if db.Driver == "sqlserver" && batchSize > 1000 {
+		batchSize = 1000
+	}
+	columns := ti.ColumnNames()
+	sortkeys := []string{}
+	if _, ok := ti.Columns["id"]; ok {
+		sortkeys = append(sortkeys, "id")
+	}
+	rows, err := ti.GetAssociativeArray(columns, "", sortkeys, "")
+	if err != nil {
+		return err
+	}
+	seq, called, hasSeq, err := db.sequenceValue(ti)
+	if err != nil {
+		return err
+	}
+	identity := db.Driver == "sqlserver" && hasSeq && len(rows) > 0
+	if identity {
+		fmt.Fprintf(w, "SET IDENTITY_INSERT %s ON;\n", ti.qualifiedName())
+	}
+	prefix := "INSERT INTO " + ti.qualifiedName() + " (" + strings.Join(columns, ",") + ") VALUES "
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		values := make([]string, 0, end-start)
+		for _, row := range rows[start:end] {
+			literals := make([]string, len(columns))
+			for i, column := range columns {
+				literals[i] = db.sqlLiteral(row[column])
+			}
+			values = append(values, "("+strings.Join(literals, ",")+")")
+		}
+		fmt.Fprintf(w, "%s%s;\n", prefix, strings.Join(values, ","))
+	}
+	if identity {
+		fmt.Fprintf(w, "SET IDENTITY_INSERT %s OFF;\n", ti.qualifiedName())
+	}
+	if hasSeq && !called {
+		// never used, the next id is the value itself
+		fmt.Fprintf(w, "%s;\n", pgSetvalQuery(ti.qualifiedName(), seq, false))
+	} else if hasSeq {
+		fmt.Fprintf(w, "%s;\n", db.resetSequenceQuery(ti.qualifiedName(), seq))
+	}
+	return nil
+}
+
+// sequenceValue : current value of the sequence feeding the id column of a table,
+// and whether it was already given, a new postgres sequence gives its value first
+func (db *Db) sequenceValue(ti TableInfo) (int64, bool, bool, error) {
+	if _, ok := ti.Columns["id"]; !ok {
+		return 0, false, false, nil
+	}
+	var query string
+	switch db.Driver {
+	case "postgres":
+		rows, err := db.readRows("SELECT pg_get_serial_sequence(" + pq.QuoteLiteral(ti.qualifiedName()) + ", 'id') as seq;")
+		if err != nil || len(rows) == 0 || rows[0]["seq"] == nil {
+			return 0, false, false, err
+		}
+		query = "SELECT last_value as value, is_called as called FROM " + fmt.Sprintf("%s", rows[0]["seq"]) + ";"
+	case "mysql":
+		query = "SELECT AUTO_INCREMENT - 1 as value FROM information_schema.TABLES WHERE " + db.schemaFilter("TABLE_SCHEMA", ti.schemaName()) + " AND TABLE_NAME = " + pq.QuoteLiteral(ti.Name) + ";"
+	case "sqlserver":
+		query = "SELECT IDENT_CURRENT(" + pq.QuoteLiteral(ti.qualifiedName()) + ") as value;"
+	default:
+		return 0, false, false, errors.New("no driver")
+	}
+	// sequences are written by inserts into the table, their values are not cached
+	rows, err := db.readRows(query)
+	if err != nil || len(rows) == 0 || rows[0]["value"] == nil {
+		return 0, false, false, err
+	}
+	value, ok := toInt64(rows[0]["value"])
+	called := true
+	if b, isBool := rows[0]["called"].(bool); isBool {
+		called = b
+	}
+	return value, called, ok, nil
+}
+
+// resetSequenceQuery : statement moving the id sequence of a table to a given value
+func (db *Db) resetSequenceQuery(table string, value int64) string {
+	switch db.Driver {
+	case "postgres":
+		if value < 1 {
+			return pgSetvalQuery(table, 1, false)
+		}
+		return pgSetvalQuery(table, value, true)
+	case "mysql":
+		return "ALTER TABLE " + table + " AUTO_INCREMENT = " + strconv.FormatInt(value+1, 10)
+	case "sqlserver":
+		return "DBCC CHECKIDENT (" + quoteString(table) + ", RESEED, " + strconv.FormatInt(value, 10) + ")"
+	}
+	return ""
+}
+
+// pgSetvalQuery : statement moving the id sequence of a postgres table, the next id is value + 1 when called, value otherwise
+func pgSetvalQuery(table string, value int64, called bool) string {
+	return "SELECT setval(pg_get_serial_sequence(" + pq.QuoteLiteral(table) + ", 'id'), " + strconv.FormatInt(value, 10) + ", " + strconv.FormatBool(called) + ")"
+}
+
+// sqlLiteral : Format a value read from the database as a literal of the current dialect
+func (db *Db) sqlLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if db.Driver == "postgres" {
+			return strconv.FormatBool(v)
+		}
+		if v {
+			return "1"
+		}
+		return "0"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		switch db.Driver {
+		case "postgres":
+			return pq.QuoteLiteral(v.Format("2006-01-02 15:04:05.999999999Z07:00"))
+		case "mysql":
+			return db.quoteLiteral(v.Format("2006-01-02 15:04:05.999999"))
+		}
+		return db.quoteLiteral(v.Format("2006-01-02T15:04:05.9999999"))
+	case []byte:
+		// binary columns, which text literals can't carry
+		if len(v) == 0 {
+			if db.Driver == "sqlserver" {
+				return "0x"
+			}
+			return "''"
+		}
+		if db.Driver == "postgres" {
+			return binaryLiteral("bytea", v)
+		}
+		return binaryLiteral("", v)
+	case json.RawMessage:
+		return db.quoteLiteral(string(v))
+	case []int64, []float64, []bool, []string:
+		if db.Driver == "postgres" {
+			array, err := pq.Array(v).Value()
+			if err == nil {
+				return db.quoteLiteral(fmt.Sprintf("%s", array))
+			}
+		}
+		array, _ := json.Marshal(v)
+		return db.quoteLiteral(string(array))
+	}
+	return db.quoteLiteral(fmt.Sprintf("%v", value))
+}
+
+// quoteLiteral : Quote a string for the current dialect
+func (db *Db) quoteLiteral(str string) string {
+	switch db.Driver {
+	case "mysql":
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(str) + "'"
+	case "sqlserver":
+		return quoteString(str)
+	}
+	return pq.QuoteLiteral(str)
+}
+
+// quoteString : standard SQL quoting, quotes are doubled
+func quoteString(str string) string {
+	return "'" + strings.ReplaceAll(str, "'", "''") + "'"
+}
+
+// Restore : Replay a SQL script produced by Dump inside a single transaction.
+// On mysql each DDL statement commits implicitly, so a failed restore keeps the tables created before the failure
+func (db *Db) Restore(r io.Reader) error {
+	script, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	tx, err := db.conn.BeginTx(db.Context(), nil)
+	if err != nil {
+		return err
+	}
+	for _, query := range splitStatements(string(script)) {
+		_, err = db.exec(tx, query)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// splitStatements : cut a script on the semicolons found outside of string literals,
+// comment lines are dropped
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	quoted := false
+	for _, line := range strings.Split(script, "\n") {
+		if !quoted && strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		for _, c := range line {
+			if c == '\'' {
+				quoted = !quoted
+			}
+			if c == ';' && !quoted {
+				if statement := strings.TrimSpace(current.String()); statement != "" {
+					statements = append(statements, statement)
+				}
+				current.Reset()
+				continue
+			}
+			current.WriteRune(c)
+		}
+		current.WriteRune('\n')
+	}
+	if statement := strings.TrimSpace(current.String()); statement != "" {
+		statements = append(statements, statement)
+	}
+	return statements
+}
+
+// toInt64 : Convert an integer value whatever its driver representation
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	case []byte:
+		return parseInt64(string(v))
+	case string:
+		return parseInt64(v)
+	}
+	return 0, false
+}
+
+func parseInt64(str string) (int64, bool) {
+	str = strings.TrimSpace(str)
+	if i, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return i, true
+	}
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int64(f), true
+}
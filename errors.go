@@ -0,0 +1,125 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+// Error classes of the database errors, whatever the driver
+const (
+	ErrorClassNone          = "none"
+	ErrorClassNoRows        = "no_rows"
+	ErrorClassConstraint    = "constraint"
+	ErrorClassSyntax        = "syntax"
+	ErrorClassConnection    = "connection"
+	ErrorClassDeadlock      = "deadlock"
+	ErrorClassSerialization = "serialization"
+	ErrorClassTimeout       = "timeout"
+	ErrorClassOther         = "other"
+)
+
+// ErrorClass : Classify an error returned by a statement
+func ErrorClass(err error) string {
+	if err == nil {
+		return ErrorClassNone
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrorClassNoRows
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return ErrorClassTimeout
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, mysql.ErrInvalidConn) {
+		return ErrorClassConnection
+	}
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		return pgErrorClass(string(pgErr.Code))
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErrorClass(myErr.Number)
+	}
+	var msErr mssql.Error
+	if errors.As(err, &msErr) {
+		return msErrorClass(msErr.Number)
+	}
+	var msErrPtr *mssql.Error
+	if errors.As(err, &msErrPtr) {
+		return msErrorClass(msErrPtr.Number)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorClassTimeout
+		}
+		return ErrorClassConnection
+	}
+	if strings.Contains(err.Error(), "connection reset") || strings.Contains(err.Error(), "broken pipe") {
+		return ErrorClassConnection
+	}
+	return ErrorClassOther
+}
+
+// pgErrorClass : postgres SQLSTATE codes
+func pgErrorClass(code string) string {
+	switch {
+	case code == "40001":
+		return ErrorClassSerialization
+	case code == "40P01":
+		return ErrorClassDeadlock
+	case code == "57014" || code == "55P03":
+		return ErrorClassTimeout
+	case strings.HasPrefix(code, "23"):
+		return ErrorClassConstraint
+	case strings.HasPrefix(code, "42"):
+		return ErrorClassSyntax
+	case strings.HasPrefix(code, "08") || code == "57P01" || code == "57P02" || code == "57P03":
+		return ErrorClassConnection
+	}
+	return ErrorClassOther
+}
+
+// myErrorClass : mysql error numbers
+func myErrorClass(number uint16) string {
+	switch number {
+	case 1213:
+		return ErrorClassDeadlock
+	case 1205, 3024:
+		return ErrorClassTimeout
+	case 1022, 1048, 1062, 1216, 1217, 1451, 1452, 3819:
+		return ErrorClassConstraint
+	case 1054, 1064, 1146, 1149:
+		return ErrorClassSyntax
+	case 1040, 1053, 2002, 2003, 2006, 2013:
+		return ErrorClassConnection
+	}
+	return ErrorClassOther
+}
+
+// msErrorClass : sqlserver error numbers
+func msErrorClass(number int32) string {
+	switch number {
+	case 1205:
+		return ErrorClassDeadlock
+	case 3960:
+		return ErrorClassSerialization
+	case 1222, -2:
+		return ErrorClassTimeout
+	case 515, 547, 2601, 2627:
+		return ErrorClassConstraint
+	case 102, 156, 207, 208:
+		return ErrorClassSyntax
+	case 233, 10053, 10054, 40613:
+		return ErrorClassConnection
+	}
+	return ErrorClassOther
+}
@@ -0,0 +1,136 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// QueryEvent : a statement run by the package, given to the hooks
+type QueryEvent struct {
+	Context      context.Context // context the statement runs in, carrying the span when traced
+	Query        string
+	Args         []interface{}
+	Duration     time.Duration          // execution time, set for AfterQuery
+	RowsAffected int64                  // -1 when unknown, as for selects
+	Err          error                  // set for AfterQuery
+	Values       map[string]interface{} // free for hooks to pass data from BeforeQuery to AfterQuery
+}
+
+// Hook : functions called around every statement, either may be nil.
+// BeforeQuery may rewrite the query and its arguments, an error aborts the statement.
+// AfterQuery is called in reverse order of registration, even when a BeforeQuery failed
+type Hook struct {
+	BeforeQuery func(event *QueryEvent) error
+	AfterQuery  func(event *QueryEvent)
+}
+
+// queryer : what statements run on, a connection pool, a connection or a transaction
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// WithContext : Provide a view of the database running its statements in a context, for cancellation and tracing
+func (db *Db) WithContext(ctx context.Context) *Db {
+	view := *db
+	view.ctx = ctx
+	return &view
+}
+
+// Context : Provide the context the statements of the database run in
+func (db *Db) Context() context.Context {
+	if db.ctx != nil {
+		return db.ctx
+	}
+	return context.Background()
+}
+
+// AddHook : Add a hook called around every statement of the database
+func (db *Db) AddHook(hook Hook) {
+	db.hooks = append(db.hooks, hook)
+}
+
+// run : Call the hooks around a statement
+func (db *Db) run(event *QueryEvent, statement func() error) error {
+	if db.schemaErr != nil {
+		return db.schemaErr
+	}
+	event.Values = make(map[string]interface{})
+	event.Context = db.Context()
+	span := db.startSpan(event)
+	var err error
+	for _, hook := range db.hooks {
+		if hook.BeforeQuery != nil {
+			if err = hook.BeforeQuery(event); err != nil {
+				break
+			}
+		}
+	}
+	start := time.Now()
+	if err == nil {
+		err = statement()
+	}
+	event.Duration = time.Since(start)
+	event.Err = err
+	for i := len(db.hooks) - 1; i >= 0; i-- {
+		if db.hooks[i].AfterQuery != nil {
+			db.hooks[i].AfterQuery(event)
+		}
+	}
+	db.logStatement(event)
+	db.observeQuery(event)
+	db.invalidateCache(event)
+	db.invalidateSchema(event)
+	db.invalidateStatements(event)
+	span.finish(err)
+	if err == nil {
+		db.slowQuery(event)
+	}
+	return err
+}
+
+// exec : Run a statement returning no rows
+func (db *Db) exec(q queryer, query string, args ...interface{}) (sql.Result, error) {
+	var res sql.Result
+	err := db.retryStatement(q, query, func() error {
+		event := &QueryEvent{Query: query, Args: args, RowsAffected: -1}
+		return db.run(event, func() error {
+			var err error
+			res, err = q.ExecContext(event.Context, event.Query, event.Args...)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err == nil {
+				event.RowsAffected = n
+			}
+			return nil
+		})
+	})
+	return res, err
+}
+
+// query : Run a statement returning rows
+func (db *Db) query(q queryer, query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := db.retryStatement(q, query, func() error {
+		event := &QueryEvent{Query: query, Args: args, RowsAffected: -1}
+		return db.run(event, func() error {
+			var err error
+			rows, err = q.QueryContext(event.Context, event.Query, event.Args...)
+			return err
+		})
+	})
+	return rows, err
+}
+
+// queryRow : Run a statement returning a single row and scan it
+func (db *Db) queryRow(q queryer, query string, args []interface{}, dest ...interface{}) error {
+	return db.retryStatement(q, query, func() error {
+		event := &QueryEvent{Query: query, Args: args, RowsAffected: -1}
+		return db.run(event, func() error {
+			return q.QueryRowContext(event.Context, event.Query, event.Args...).Scan(dest...)
+		})
+	})
+}
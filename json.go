@@ -0,0 +1,307 @@
+package sqldb
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSONOptions : tune JSON import and export
+type JSONOptions struct {
+	NDJSON bool     // one object per line instead of an array, guessed on import
+	Key    []string // columns identifying a row, matching rows are updated instead of inserted
+	DryRun bool     // check the rows without writing them
+}
+
+// ExportJSON : Write table data as a JSON array of objects, or newline delimited objects
+func (t *TableInfo) ExportJSON(w io.Writer, columns []string, restriction string, opts ...JSONOptions) error {
+	var opt JSONOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	schema, err := t.GetSchema()
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 || (len(columns) == 1 && columns[0] == "*") {
+		columns = schema.ColumnNames()
+	}
+	rows, err := t.GetAssociativeArray(columns, restriction, []string{}, "")
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	if !opt.NDJSON {
+		bw.WriteString("[")
+	}
+	for i, row := range rows {
+		object := make(map[string]interface{}, len(row))
+		for key, value := range row {
+			object[key] = jsonValue(t.db.Driver, schema.Columns[key], value)
+		}
+		line, err := json.Marshal(object)
+		if err != nil {
+			return err
+		}
+		if !opt.NDJSON && i > 0 {
+			bw.WriteString(",")
+		}
+		bw.Write(line)
+		if opt.NDJSON {
+			bw.WriteString("\n")
+		}
+	}
+	if !opt.NDJSON {
+		bw.WriteString("]\n")
+	}
+	return bw.Flush()
+}
+
+// jsonValue : JSON friendly form of a database value, numbers keep their exact representation and binaries are base64
+func jsonValue(driver string, sqltype string, value interface{}) interface{} {
+	base, args, _ := splitType(sqltype)
+	generic, _ := genericType(driver, base, args)
+	switch v := booleanValue(driver, sqltype, value).(type) {
+	case bool:
+		return v
+	case []byte:
+		if generic == "decimal" {
+			return jsonNumber(string(v))
+		}
+		if generic == "json" && json.Valid(v) {
+			return json.RawMessage(v)
+		}
+		if generic == "binary" {
+			return v
+		}
+		return string(v)
+	case string:
+		if generic == "decimal" {
+			return jsonNumber(v)
+		}
+		if generic == "json" && json.Valid([]byte(v)) {
+			return json.RawMessage(v)
+		}
+		// mysql VARBINARY is read as a string, ImportJSON decodes binaries from base64 whatever their driver
+		if generic == "binary" {
+			return []byte(v)
+		}
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return strconv.FormatFloat(float64(v), 'g', -1, 32)
+		}
+	case time.Time:
+		switch generic {
+		case "date":
+			return v.Format("2006-01-02")
+		case "time":
+			return v.Format("15:04:05.999999999")
+		}
+		return v.Format(time.RFC3339Nano)
+	}
+	return value
+}
+
+// jsonNumber : JSON number of a decimal text, the text itself for NaN and infinities which JSON numbers can't carry
+func jsonNumber(str string) interface{} {
+	if str == strings.TrimSpace(str) && json.Valid([]byte(str)) {
+		return json.Number(str)
+	}
+	return str
+}
+
+// ImportJSON : Insert, or update by key, the rows of a JSON array or of newline delimited objects
+func (t *TableInfo) ImportJSON(r io.Reader, opts JSONOptions) (*ImportReport, error) {
+	schema, err := t.GetSchema()
+	if err != nil {
+		return nil, err
+	}
+	if len(schema.Columns) == 0 {
+		return nil, errors.New("import: unknown table " + t.Name)
+	}
+	br := bufio.NewReader(r)
+	var first []byte
+	for {
+		first, err = br.Peek(1)
+		if err == io.EOF {
+			return &ImportReport{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(first[0])) {
+			break
+		}
+		br.ReadByte()
+	}
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+	array := first[0] == '['
+	if array {
+		dec.Token()
+	}
+	report := &ImportReport{}
+	ignored := make(map[string]bool)
+	for line := 1; ; line++ {
+		if array && !dec.More() {
+			break
+		}
+		var object map[string]interface{}
+		err = dec.Decode(&object)
+		if err == io.EOF && !array {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("import: element %d: %w", line, err)
+		}
+		report.Rows++
+		record, importerr := schema.jsonRecord(object, ignored)
+		if importerr != nil {
+			importerr.Line = line
+			report.Errors = append(report.Errors, *importerr)
+			continue
+		}
+		if opts.DryRun {
+			continue
+		}
+		_, updated, err := schema.upsert(record, opts.Key)
+		if err != nil {
+			report.Errors = append(report.Errors, ImportError{Line: line, Err: err.Error()})
+			continue
+		}
+		if updated {
+			report.Updated++
+		} else {
+			report.Imported++
+		}
+	}
+	for key := range ignored {
+		report.Ignored = append(report.Ignored, key)
+	}
+	sort.Strings(report.Ignored)
+	return report, nil
+}
+
+func (t *TableInfo) jsonRecord(object map[string]interface{}, ignored map[string]bool) (AssRow, *ImportError) {
+	record := make(AssRow)
+	for key, value := range object {
+		sqltype, ok := t.Columns[key]
+		if !ok {
+			ignored[key] = true
+			continue
+		}
+		base, args, _ := splitType(sqltype)
+		generic, _ := genericType(t.db.Driver, base, args)
+		var err error
+		switch v := value.(type) {
+		case nil, bool:
+			record[key] = v
+		case json.Number:
+			record[key], err = coerceValue(t.db.Driver, sqltype, v.String())
+			if generic == "boolean" {
+				record[key] = v.String() != "0"
+				err = nil
+			}
+		case string:
+			switch generic {
+			case "text", "varchar", "char":
+				record[key] = v
+			case "binary":
+				// ExportJSON writes binary values in base64
+				record[key], err = base64.StdEncoding.DecodeString(v)
+			default:
+				record[key], err = coerceValue(t.db.Driver, sqltype, v)
+			}
+		default:
+			// objects and arrays are stored as their JSON text
+			var raw []byte
+			raw, err = json.Marshal(v)
+			record[key] = string(raw)
+		}
+		if err != nil {
+			return nil, &ImportError{Column: key, Err: err.Error()}
+		}
+	}
+	if len(record) == 0 {
+		return nil, &ImportError{Err: "no field maps to a column"}
+	}
+	return record, nil
+}
+
+// Upsert : Update the row matching the record on the key columns, insert it when there is none
+func (t *TableInfo) Upsert(record AssRow, keys ...string) (int64, error) {
+	schema, err := t.GetSchema()
+	if err != nil {
+		return -1, err
+	}
+	id, _, err := schema.upsert(record, keys)
+	return id, err
+}
+
+// upsert : Upsert on a table carrying its schema, tells if the row was updated
+func (t *TableInfo) upsert(record AssRow, keys []string) (int64, bool, error) {
+	if len(keys) == 0 {
+		id, err := t.Insert(record)
+		return id, false, err
+	}
+	var restriction []string
+	for _, key := range keys {
+		value, ok := record[key]
+		if !ok {
+			return -1, false, errors.New("upsert: missing key column " + key)
+		}
+		if value == nil {
+			restriction = append(restriction, key+" IS NULL")
+		} else {
+			restriction = append(restriction, key+" = "+FormatForSQL(t.Columns[key], value))
+		}
+	}
+	rows, err := t.GetAssociativeArray([]string{"id"}, strings.Join(restriction, " AND "), []string{}, "")
+	if err != nil {
+		return -1, false, err
+	}
+	if len(rows) == 0 {
+		id, err := t.Insert(record)
+		return id, false, err
+	}
+	id, _ := toInt64(rows[0]["id"])
+	if !hasValues(record, keys) {
+		// nothing to set beside the key the row already has
+		return id, true, nil
+	}
+	updated := make(AssRow, len(record)+1)
+	for key, value := range record {
+		updated[key] = value
+	}
+	updated["id"] = id
+	return id, true, t.Update(updated)
+}
+
+// hasValues : tells if a record has columns other than the key and id
+func hasValues(record AssRow, keys []string) bool {
+	for column := range record {
+		if column == "id" {
+			continue
+		}
+		isKey := false
+		for _, key := range keys {
+			isKey = isKey || key == column
+		}
+		if !isKey {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package sqldb
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	statementTable = regexp.MustCompile(`(?i)\b(?:from|into|update|table(?:\s+if\s+(?:not\s+)?exists)?|on\s+column)\s+([\w."\[\]]+)`)
+	// an update names its table before SET, unlike ON CONFLICT DO UPDATE SET and FOR UPDATE
+	writeStatement = regexp.MustCompile(`(?i)\b(?:(insert)\s+into\s+([\w."\[\]]+)|(update)\s+([\w."\[\]]+)(?:\s+(?:as\s+)?\w+)?\s+set\b|(delete)\s+from\s+([\w."\[\]]+))`)
+)
+
+// SetLogger : Log the statements and the failures of the database with the given logger, SetSlogHandler takes a log/slog handler from go 1.21
+func (db *Db) SetLogger(logger zerolog.Logger) {
+	db.logger = &logger
+}
+
+// Logger : Provide the logger of the database, the package logger when none was set
+func (db *Db) Logger() *zerolog.Logger {
+	if db.logger != nil {
+		return db.logger
+	}
+	return &log
+}
+
+// logStatement : Log a statement with its driver, operation, table, duration and row count.
+// Statements are logged when LogQueries is set, literals and arguments are redacted unless LogValues is set
+func (db *Db) logStatement(event *QueryEvent) {
+	if !db.LogQueries {
+		return
+	}
+	operation, table := statementInfo(event.Query)
+	logger := db.Logger()
+	e := logger.Info()
+	if event.Err != nil {
+		e = logger.Error().Err(event.Err)
+	}
+	e = e.Str("driver", db.Driver).
+		Str("operation", operation).
+		Str("table", table).
+		Dur("duration", event.Duration)
+	if event.RowsAffected >= 0 {
+		e = e.Int64("rows", event.RowsAffected)
+	}
+	if db.LogValues {
+		e = e.Interface("args", event.Args)
+		e.Msg(event.Query)
+		return
+	}
+	if len(event.Args) > 0 {
+		e = e.Int("args", len(event.Args))
+	}
+	e.Msg(SanitizeQuery(event.Query))
+}
+
+// SanitizeQuery : Replace the string and numeric literals of a statement by ?
+func SanitizeQuery(query string) string {
+	query = stringLiteral.ReplaceAllString(query, "?")
+	return numericLiteral.ReplaceAllString(query, "?")
+}
+
+// statementInfo : operation, select, insert, update, delete, ddl or other, and main table of a statement
+func statementInfo(query string) (string, string) {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "other", ""
+	}
+	operation := strings.ToLower(fields[0])
+	switch operation {
+	case "select", "insert", "update", "delete":
+	case "with":
+		// data modifying CTEs make the statement a write, of the first of them
+		operation = "select"
+		if write := writeStatement.FindStringSubmatch(stringLiteral.ReplaceAllString(query, "''")); write != nil {
+			return writeInfo(write)
+		}
+	case "create", "alter", "drop", "truncate", "comment":
+		operation = "ddl"
+	default:
+		operation = "other"
+	}
+	table := ""
+	if match := statementTable.FindStringSubmatch(query); match != nil {
+		table = strings.Trim(match[1], `"[]`)
+		// COMMENT ON COLUMN names table.column
+		if strings.EqualFold(fields[0], "comment") {
+			if i := strings.LastIndex(table, "."); i >= 0 {
+				table = table[:i]
+			}
+		}
+	}
+	return operation, table
+}
+
+// writtenTables : tables an insert, update or delete statement writes, the ones of its data modifying CTEs included
+func writtenTables(query string) []string {
+	var tables []string
+	for _, write := range writeStatement.FindAllStringSubmatch(stringLiteral.ReplaceAllString(query, "''"), -1) {
+		_, table := writeInfo(write)
+		tables = append(tables, table)
+	}
+	if len(tables) == 0 {
+		_, table := statementInfo(query)
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+// writeInfo : operation and table of a match of writeStatement
+func writeInfo(match []string) (string, string) {
+	return strings.ToLower(match[1] + match[3] + match[5]), strings.Trim(match[2]+match[4]+match[6], `"[]`)
+}
@@ -0,0 +1,249 @@
+package sqldb
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueryMetric : measure of a statement given to the metrics collector
+type QueryMetric struct {
+	Driver     string
+	Operation  string // select, insert, update, delete, ddl or other
+	Table      string
+	Duration   time.Duration
+	ErrorClass string // ErrorClassNone when the statement succeeded
+}
+
+// MetricsCollector : receives a measure of every statement of a database
+type MetricsCollector interface {
+	ObserveQuery(metric QueryMetric)
+}
+
+// SetMetrics : Report every statement of the database to a collector
+func (db *Db) SetMetrics(collector MetricsCollector) {
+	db.metrics = collector
+}
+
+// Stats : Provide the connection pool statistics
+func (db *Db) Stats() sql.DBStats {
+	return db.conn.Stats()
+}
+
+// observeQuery : Report a statement to the metrics collector
+func (db *Db) observeQuery(event *QueryEvent) {
+	if db.metrics == nil {
+		return
+	}
+	operation, table := statementInfo(event.Query)
+	db.metrics.ObserveQuery(QueryMetric{
+		Driver:     db.Driver,
+		Operation:  operation,
+		Table:      table,
+		Duration:   event.Duration,
+		ErrorClass: ErrorClass(event.Err),
+	})
+}
+
+// DefaultBuckets : upper bounds in seconds of the latency histogram buckets
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics : MetricsCollector exporting counters, latency histograms and pool gauges in Prometheus text format
+type PrometheusMetrics struct {
+	Buckets []float64 // upper bounds of the histograms, read when a histogram is first used
+	mutex   sync.Mutex
+	queries map[queryKey]*histogram
+	errors  map[errorKey]int64
+	pools   map[string]*Db
+}
+
+type queryKey struct {
+	driver, operation, table string
+}
+
+type errorKey struct {
+	driver, operation, class string
+}
+
+type histogram struct {
+	buckets []float64 // copy of the buckets when created
+	counts  []int64   // per bucket, not cumulated
+	count   int64
+	sum     float64
+}
+
+// NewPrometheusMetrics : Create a collector with the default buckets
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{
+		Buckets: append([]float64(nil), DefaultBuckets...),
+		queries: make(map[queryKey]*histogram),
+		errors:  make(map[errorKey]int64),
+		pools:   make(map[string]*Db),
+	}
+}
+
+// ObserveQuery : Count a statement
+func (m *PrometheusMetrics) ObserveQuery(metric QueryMetric) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := queryKey{metric.Driver, metric.Operation, metric.Table}
+	h, ok := m.queries[key]
+	if !ok {
+		buckets := append([]float64(nil), m.Buckets...)
+		h = &histogram{buckets: buckets, counts: make([]int64, len(buckets))}
+		m.queries[key] = h
+	}
+	seconds := metric.Duration.Seconds()
+	for i, bound := range h.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+	if metric.ErrorClass != ErrorClassNone {
+		m.errors[errorKey{metric.Driver, metric.Operation, metric.ErrorClass}]++
+	}
+}
+
+// AddPool : Export the connection pool gauges of a database under a name
+func (m *PrometheusMetrics) AddPool(name string, db *Db) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.pools[name] = db
+}
+
+// WriteTo : Write the metrics in Prometheus text format
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+
+	queryKeys := make([]queryKey, 0, len(m.queries))
+	for key := range m.queries {
+		queryKeys = append(queryKeys, key)
+	}
+	sort.Slice(queryKeys, func(i, j int) bool {
+		return fmt.Sprint(queryKeys[i]) < fmt.Sprint(queryKeys[j])
+	})
+	cw.header("sqldb_queries_total", "counter", "Statements run, by operation and table.")
+	for _, key := range queryKeys {
+		cw.sample("sqldb_queries_total", queryLabels(key), float64(m.queries[key].count))
+	}
+	cw.header("sqldb_query_duration_seconds", "histogram", "Statement latency, by operation and table.")
+	for _, key := range queryKeys {
+		h := m.queries[key]
+		labels := queryLabels(key)
+		var cumulated int64
+		for i, bound := range h.buckets {
+			cumulated += h.counts[i]
+			cw.sample("sqldb_query_duration_seconds_bucket", append(labels, "le", formatFloat(bound)), float64(cumulated))
+		}
+		cw.sample("sqldb_query_duration_seconds_bucket", append(labels, "le", "+Inf"), float64(h.count))
+		cw.sample("sqldb_query_duration_seconds_sum", labels, h.sum)
+		cw.sample("sqldb_query_duration_seconds_count", labels, float64(h.count))
+	}
+
+	errorKeys := make([]errorKey, 0, len(m.errors))
+	for key := range m.errors {
+		errorKeys = append(errorKeys, key)
+	}
+	sort.Slice(errorKeys, func(i, j int) bool {
+		return fmt.Sprint(errorKeys[i]) < fmt.Sprint(errorKeys[j])
+	})
+	cw.header("sqldb_query_errors_total", "counter", "Failed statements, by operation and error class.")
+	for _, key := range errorKeys {
+		cw.sample("sqldb_query_errors_total", []string{"driver", key.driver, "operation", key.operation, "class", key.class}, float64(m.errors[key]))
+	}
+
+	names := make([]string, 0, len(m.pools))
+	for name := range m.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	gauges := []struct {
+		name, kind, help string
+		value            func(sql.DBStats) float64
+	}{
+		{"sqldb_pool_max_open_connections", "gauge", "Maximum number of open connections.", func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }},
+		{"sqldb_pool_open_connections", "gauge", "Open connections, in use and idle.", func(s sql.DBStats) float64 { return float64(s.OpenConnections) }},
+		{"sqldb_pool_in_use_connections", "gauge", "Connections in use.", func(s sql.DBStats) float64 { return float64(s.InUse) }},
+		{"sqldb_pool_idle_connections", "gauge", "Idle connections.", func(s sql.DBStats) float64 { return float64(s.Idle) }},
+		{"sqldb_pool_wait_count_total", "counter", "Connections waited for.", func(s sql.DBStats) float64 { return float64(s.WaitCount) }},
+		{"sqldb_pool_wait_duration_seconds_total", "counter", "Time blocked waiting for a connection.", func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }},
+		{"sqldb_pool_max_idle_closed_total", "counter", "Connections closed by SetMaxIdleConns.", func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }},
+		{"sqldb_pool_max_idle_time_closed_total", "counter", "Connections closed by SetConnMaxIdleTime.", func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }},
+		{"sqldb_pool_max_lifetime_closed_total", "counter", "Connections closed by SetConnMaxLifetime.", func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }},
+	}
+	stats := make([]sql.DBStats, len(names))
+	for i, name := range names {
+		stats[i] = m.pools[name].Stats()
+	}
+	for _, gauge := range gauges {
+		if len(names) == 0 {
+			break
+		}
+		cw.header(gauge.name, gauge.kind, gauge.help)
+		for i, name := range names {
+			cw.sample(gauge.name, []string{"pool", name}, gauge.value(stats[i]))
+		}
+	}
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP : Serve the metrics to a Prometheus scraper
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+func queryLabels(key queryKey) []string {
+	return []string{"driver", key.driver, "operation", key.operation, "table", key.table}
+}
+
+// countingWriter : writer keeping the first error and the count of bytes written
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) write(str string) {
+	if cw.err != nil {
+		return
+	}
+	n, err := cw.w.WriteString(str)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+func (cw *countingWriter) header(name string, kind string, help string) {
+	cw.write("# HELP " + name + " " + help + "\n# TYPE " + name + " " + kind + "\n")
+}
+
+// sample : Write a sample, labels are given as name, value pairs
+func (cw *countingWriter) sample(name string, labels []string, value float64) {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+escapeLabel(labels[i+1])+`"`)
+	}
+	cw.write(name + "{" + strings.Join(pairs, ",") + "} " + formatFloat(value) + "\n")
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return fmt.Sprintf("%g", value)
+}
@@ -1,6 +1,7 @@
 package sqldb
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -223,3 +224,18 @@ func TestMyGenerateTableTemplate(t *testing.T) {
 		fmt.Println(err.Error())
 	}
 }
+
+func TestMyDumpRestore(t *testing.T) {
+	db := Open("mysql", "test:test@tcp(127.0.0.1:3306)/test?parseTime=true")
+	defer db.Close()
+	var buf bytes.Buffer
+	err := db.Dump(&buf, DumpOptions{DropTables: true, BatchSize: 100})
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	fmt.Println(buf.String())
+	err = db.Restore(&buf)
+	if err != nil {
+		t.Errorf("Restore failed : %s", err.Error())
+	}
+}
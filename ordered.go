@@ -0,0 +1,194 @@
+package sqldb
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+)
+
+// Column : description of a result column
+type Column struct {
+	Name         string `json:"name"`
+	DatabaseType string `json:"type"`
+	Nullable     bool   `json:"nullable"`
+	Length       int64  `json:"length,omitempty"`
+	Precision    int64  `json:"precision,omitempty"`
+	Scale        int64  `json:"scale,omitempty"`
+}
+
+// OrderedRows : Select result keeping the columns in select order
+type OrderedRows struct {
+	Columns []Column
+	Values  [][]interface{}
+	index   map[string]int
+}
+
+// OrderedRow : one row of an OrderedRows
+type OrderedRow struct {
+	rows   *OrderedRows
+	Values []interface{}
+}
+
+func newOrderedRows(columnTypes []*sql.ColumnType) *OrderedRows {
+	res := &OrderedRows{
+		Columns: make([]Column, len(columnTypes)),
+		Values:  [][]interface{}{},
+		index:   make(map[string]int, len(columnTypes)),
+	}
+	for i, colType := range columnTypes {
+		column := Column{Name: colType.Name(), DatabaseType: colType.DatabaseTypeName()}
+		column.Nullable, _ = colType.Nullable()
+		column.Length, _ = colType.Length()
+		column.Precision, column.Scale, _ = colType.DecimalSize()
+		res.Columns[i] = column
+		// the last column of a name wins, as for the associative array
+		res.index[column.Name] = i
+	}
+	return res
+}
+
+// Len : number of rows
+func (r *OrderedRows) Len() int {
+	return len(r.Values)
+}
+
+// Names : Provide the column names in select order
+func (r *OrderedRows) Names() []string {
+	names := make([]string, len(r.Columns))
+	for i, column := range r.Columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+// Index : position of a column, -1 when the result has no such column
+func (r *OrderedRows) Index(column string) int {
+	if r.index == nil {
+		r.index = make(map[string]int, len(r.Columns))
+		for i, column := range r.Columns {
+			r.index[column.Name] = i
+		}
+	}
+	if i, ok := r.index[column]; ok {
+		return i
+	}
+	return -1
+}
+
+// Row : Provide a row of the result
+func (r *OrderedRows) Row(i int) OrderedRow {
+	return OrderedRow{rows: r, Values: r.Values[i]}
+}
+
+// Get : value of a column of a row, nil when the result has no such column
+func (r *OrderedRows) Get(row int, column string) interface{} {
+	return r.Row(row).Get(column)
+}
+
+// Rows : Convert the result to associative rows
+func (r *OrderedRows) Rows() Rows {
+	results := make(Rows, 0, len(r.Values))
+	for i := range r.Values {
+		results = append(results, r.Row(i).AssRow())
+	}
+	return results
+}
+
+// MarshalJSON : Write the result as an array of objects, keys in select order
+func (r *OrderedRows) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i := range r.Values {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		row, err := r.Row(i).MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(row)
+	}
+	buf.WriteString("]")
+	return buf.Bytes(), nil
+}
+
+// Lookup : value of a column, tells if the row has such a column
+func (row OrderedRow) Lookup(column string) (interface{}, bool) {
+	i := row.rows.Index(column)
+	if i < 0 {
+		return nil, false
+	}
+	return row.Values[i], true
+}
+
+// Get : value of a column, nil when the row has no such column
+func (row OrderedRow) Get(column string) interface{} {
+	value, _ := row.Lookup(column)
+	return value
+}
+
+// Strict : Provide the strict accessors of the row, as for AssRow
+func (row OrderedRow) Strict() StrictRow {
+	return StrictRow{lookup: row.Lookup}
+}
+
+// IsNull : tells if a column is NULL or missing
+func (row OrderedRow) IsNull(column string) bool {
+	return row.Get(column) == nil
+}
+
+// GetString : value of a column as a string, empty when NULL
+func (row OrderedRow) GetString(column string) string {
+	str, _ := row.Strict().String(column)
+	return str
+}
+
+// GetInt : value of a column as an int, 0 when NULL or not a number
+func (row OrderedRow) GetInt(column string) int {
+	val, _ := row.Strict().Int64(column)
+	return int(val)
+}
+
+// GetFloat : value of a column as a float, 0 when NULL or not a number
+func (row OrderedRow) GetFloat(column string) float64 {
+	val, _ := row.Strict().Float64(column)
+	return val
+}
+
+// AssRow : Convert the row to an associative row
+func (row OrderedRow) AssRow() AssRow {
+	m := make(AssRow, len(row.Values))
+	for i, column := range row.rows.Columns {
+		m[column.Name] = row.Values[i]
+	}
+	return m
+}
+
+// MarshalJSON : Write the row as an object, keys in select order
+func (row OrderedRow) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, column := range row.rows.Columns {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		key, err := json.Marshal(column.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(row.Values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteString(":")
+		buf.Write(value)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+// GetOrderedArray : Provide table data with its columns in select order
+func (t *TableInfo) GetOrderedArray(columns []string, restriction string, sortkeys []string, dir string) (*OrderedRows, error) {
+	return t.db.selectOrdered(t.buildSelect("", columns, restriction, sortkeys, dir))
+}
@@ -1,10 +1,27 @@
 package sqldb
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
 )
 
 func TestPgCreateTable(t *testing.T) {
@@ -212,6 +229,14 @@ func TestPgGenerateTemplate(t *testing.T) {
 	if err != nil {
 		fmt.Println(err.Error())
 	}
+	generated := filepath.Join(t.TempDir(), "kept.puml")
+	os.WriteFile(generated, []byte("previous"), 0644)
+	if err = db.GenerateSchemaTemplate("missing.tmpl", generated); err == nil {
+		t.Errorf("Missing template should fail")
+	}
+	if previous, _ := os.ReadFile(generated); string(previous) != "previous" {
+		t.Errorf("Failed generation truncated the output : %q", previous)
+	}
 }
 
 func TestPgGenerateTableTemplate(t *testing.T) {
@@ -222,3 +247,785 @@ func TestPgGenerateTableTemplate(t *testing.T) {
 		fmt.Println(err.Error())
 	}
 }
+
+func TestPgDumpRestore(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	binary := []byte{0xff, 0x00, 'a'}
+	if literal := db.sqlLiteral(binary); literal != `'\xff0061'` {
+		t.Errorf("Wrong bytea literal : %s", literal)
+	}
+	if literal := (&Db{Driver: "sqlserver"}).sqlLiteral(binary); literal != "0xff0061" {
+		t.Errorf("Wrong varbinary literal : %s", literal)
+	}
+	var buf bytes.Buffer
+	err := db.Dump(&buf, DumpOptions{DropTables: true, BatchSize: 100})
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	fmt.Println(buf.String())
+	err = db.Restore(&buf)
+	if err != nil {
+		t.Errorf("Restore failed : %s", err.Error())
+	}
+	err = db.CreateTable(TableInfo{Name: "bytestest", Columns: map[string]string{"id": "integer", "data": "bytea"}})
+	if err != nil {
+		return
+	}
+	defer db.Table("bytestest").DeleteTable()
+	db.Table("bytestest").Insert(AssRow{"data": binary})
+	buf.Reset()
+	if err = db.Dump(&buf, DumpOptions{Tables: []string{"bytestest"}, DropTables: true}); err != nil {
+		t.Errorf("Dump failed : %s", err.Error())
+	}
+	if err = db.Restore(&buf); err != nil {
+		t.Errorf("Restore of bytea failed : %s", err.Error())
+	}
+	rows, _ := db.Table("bytestest").GetAssociativeArray([]string{"data"}, "", []string{}, "")
+	if len(rows) != 1 {
+		t.Errorf("Bytea not restored : %v", rows)
+	} else if data, _ := rows[0]["data"].([]byte); !bytes.Equal(data, binary) {
+		t.Errorf("Bytea not restored : %v", rows)
+	}
+}
+
+func TestCopyMyToPg(t *testing.T) {
+	src := Open("mysql", "test:test@tcp(127.0.0.1:3306)/test?parseTime=true")
+	defer src.Close()
+	dst := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer dst.Close()
+	if TranslateType("mysql", "postgres", "tinyint(1)") != "boolean" || TranslateType("mysql", "postgres", "tinyint(4)") != "smallint" {
+		t.Errorf("Wrong tinyint translation")
+	}
+	if value, _ := src.convertValue("TINYINT", []byte("5")); value != int64(5) || booleanValue("postgres", "smallint", value) != int64(5) || booleanValue("postgres", "boolean", int64(1)) != true {
+		t.Errorf("Wrong tinyint value : %v", value)
+	}
+	results, err := Copy(src, dst, CopyOptions{Tables: []string{"test"}, Truncate: true})
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	for _, result := range results {
+		if result.Mismatch {
+			t.Errorf("Copy of %s : %d rows read, %d copied", result.Table, result.SourceRows, result.CopiedRows)
+		}
+	}
+	if _, err = src.exec(src.conn, "CREATE TABLE tinytest (id INT AUTO_INCREMENT PRIMARY KEY, level TINYINT(4), flag TINYINT(1))"); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer src.Table("tinytest").DeleteTable()
+	defer dst.Table("tinytest").DeleteTable()
+	src.Table("tinytest").Insert(AssRow{"level": 5, "flag": true})
+	if _, err = Copy(src, dst, CopyOptions{Tables: []string{"tinytest"}}); err != nil {
+		t.Errorf("Can't copy tinyint : %s", err.Error())
+		return
+	}
+	rows, _ := dst.Table("tinytest").GetAssociativeArray([]string{"level", "flag"}, "", []string{}, "")
+	if len(rows) != 1 || rows[0]["level"] != int64(5) || rows[0]["flag"] != true {
+		t.Errorf("Wrong tinyint copy : %v", rows)
+	}
+}
+
+func TestPgCSV(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	if _, err := coerceValue("postgres", "numeric(10,2)", "1,234"); err == nil {
+		t.Errorf("Thousands separator read as a decimal comma")
+	}
+	table := TableInfo{Name: "prices", Columns: map[string]string{"price": "double precision"}, db: db}
+	if record, _ := table.csvRecord([]string{"price"}, []string{"1,5"}, CSVOptions{DecimalComma: true}); record["price"] != 1.5 {
+		t.Errorf("Decimal comma not read : %v", record)
+	}
+	if _, csverr := table.csvRecord([]string{"price"}, []string{"1,5"}, CSVOptions{}); csverr == nil {
+		t.Errorf("Decimal comma read without the option")
+	}
+	var buf bytes.Buffer
+	err := db.Table("test").ExportCSV(&buf, []string{"name", "description", "startdate", "boolvalue"}, "")
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	fmt.Println(buf.String())
+	csv := "name;startdate;boolvalue;price\ntoto;2022-09-01;true;1,5\ntiti;notadate;yes;2\n"
+	report, err := db.Table("test").ImportCSV(strings.NewReader(csv), CSVOptions{Delimiter: ';', DryRun: true, DecimalComma: true})
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Line != 3 {
+		t.Errorf("Dry run should reject line 3 : %v", report.Errors)
+	}
+	if _, err = db.Table("test").ImportCSV(strings.NewReader("other\n1\n"), CSVOptions{}); err == nil {
+		t.Errorf("Import without mapped field should fail")
+	}
+	if _, err = db.Table("test").Insert(AssRow{}); err == nil {
+		t.Errorf("Insert of an empty record should fail")
+	}
+}
+
+func TestPgJSON(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	table := TableInfo{Name: "blob", Columns: map[string]string{"data": "bytea", "label": "varchar(20)"}, db: db}
+	record, importerr := table.jsonRecord(map[string]interface{}{"data": "AQL/"}, map[string]bool{})
+	if data, _ := record["data"].([]byte); importerr != nil || !bytes.Equal(data, []byte{1, 2, 255}) || FormatForSQL("bytea", record["data"]) != `'\x0102ff'` {
+		t.Errorf("Binary not decoded : %v %v", record, importerr)
+	}
+	if _, importerr = table.jsonRecord(map[string]interface{}{"other": 1}, map[string]bool{}); importerr == nil {
+		t.Errorf("Record without column should be rejected")
+	}
+	line, err := json.Marshal(map[string]interface{}{
+		"bin": jsonValue("mysql", "varbinary(10)", "\x01\x02\xff"),
+		"nan": jsonValue("postgres", "numeric", "NaN"),
+		"inf": jsonValue("postgres", "double precision", math.Inf(1)),
+		"num": jsonValue("postgres", "numeric(10,2)", []byte("12.50")),
+	})
+	if err != nil || string(line) != `{"bin":"AQL/","inf":"+Inf","nan":"NaN","num":12.50}` {
+		t.Errorf("Wrong JSON values : %s %v", line, err)
+	}
+	var buf bytes.Buffer
+	err = db.Table("test").ExportJSON(&buf, []string{"*"}, "", JSONOptions{NDJSON: true})
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	fmt.Println(buf.String())
+	report, err := db.Table("test").ImportJSON(&buf, JSONOptions{Key: []string{"id"}})
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if len(report.Errors) > 0 || report.Imported > 0 {
+		t.Errorf("Rows should be updated in place : %v", report)
+	}
+}
+
+func TestPgGenerateDiagrams(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	var buf bytes.Buffer
+	err := db.GenerateMermaid(&buf, DiagramOptions{Tables: []string{"test"}, Depth: 1})
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	err = db.GenerateGraphviz(&buf, DiagramOptions{})
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	fmt.Println(buf.String())
+}
+
+func TestPgTextTemplate(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	tmpl := fstest.MapFS{"struct.tmpl": &fstest.MapFile{Data: []byte("type {{pascalCase .Name}} struct {\n{{range .Fields}}\t{{pascalCase .Name}} {{goType .Type}} `json:\"{{.Name}}\"`\n{{end}}}\n")}}
+	out := MemoryFS{}
+	err := db.ExecuteTableTemplates(out, "struct.tmpl", "go", TemplateOptions{Text: true, FS: tmpl})
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if gen, ok := out["test.go"]; !ok || strings.Contains(gen.String(), "&#34;") {
+		t.Errorf("Generated struct missing or escaped")
+	}
+}
+
+func TestPgQueryOrdered(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	manual := &OrderedRows{Columns: []Column{{Name: "label"}, {Name: "count"}}, Values: [][]interface{}{{nil, []byte("42")}}}
+	if row := manual.Row(0); row.GetString("label") != "" || row.GetInt("count") != 42 || !row.IsNull("label") {
+		t.Errorf("Ordered row accessors differ from AssRow : %q %d", row.GetString("label"), row.GetInt("count"))
+	}
+	res, err := db.Table("test").GetOrderedArray([]string{"name", "id", "description"}, "", []string{"id"}, "")
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if strings.Join(res.Names(), ",") != "name,id,description" {
+		t.Errorf("Column order lost : %v", res.Names())
+	}
+	val, _ := json.Marshal(res)
+	fmt.Println(string(val))
+}
+
+func TestPgRegisterConverter(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	db.RegisterConverter("NUMERIC", func(value interface{}) (interface{}, error) {
+		return strconv.ParseFloat(string(value.([]byte)), 64)
+	})
+	rows, err := db.QueryAssociativeArray("SELECT 1.5 :: numeric as num, '01234567-89ab-cdef-0123-456789abcdef' :: uuid as uid")
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if _, ok := rows[0]["num"].(float64); !ok {
+		t.Errorf("Registered converter not applied : %T", rows[0]["num"])
+	}
+	if rows[0]["uid"] != "01234567-89ab-cdef-0123-456789abcdef" {
+		t.Errorf("Unexpected uuid : %v", rows[0]["uid"])
+	}
+}
+
+func TestPgTypedAccessors(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	rows, err := db.QueryAssociativeArray("SELECT NULL :: integer as missing, 42 as num, true as flag, '{\"a\": 1}' :: jsonb as doc")
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	row := rows[0]
+	if _, err := row.Strict().Int64("missing"); !errors.Is(err, ErrNullValue) {
+		t.Errorf("NULL not reported : %v", err)
+	}
+	if _, ok := row.GetIntOk("missing"); ok || row.GetNullString("missing").Valid || row.GetString("missing") != "" {
+		t.Errorf("NULL read as a value")
+	}
+	if row.GetInt64("num") != 42 || !row.GetBool("flag") {
+		t.Errorf("Unexpected values : %v", row)
+	}
+	var doc map[string]int
+	if err := row.GetJSON("doc", &doc); err != nil || doc["a"] != 1 {
+		t.Errorf("JSON not decoded : %v", err)
+	}
+}
+
+func TestRowsJoin(t *testing.T) {
+	users := Rows{{"id": int64(1), "name": "alice"}, {"id": int32(2), "name": "bob"}}
+	orders := Rows{{"user_id": uint64(1), "total": 10.5}, {"user_id": int16(2), "total": 3.0}, {"user_id": float64(1), "total": 7.0}}
+	if _, ok := users.IndexBy("id")[int64(2)]; !ok {
+		t.Errorf("int32 key not normalized")
+	}
+	joined := orders.JoinOn(users, "user_id", "id").SortBy("name", "-total")
+	if len(joined) != 3 || joined[0]["name"] != "alice" || joined[0]["total"] != 10.5 {
+		t.Errorf("Unexpected join : %v", joined)
+	}
+	groups := joined.GroupBy("name")
+	if len(groups) != 2 || len(groups[0].Rows) != 2 {
+		t.Errorf("Unexpected groups : %v", groups)
+	}
+	if _, err := (&Db{}).BuildIdMap("user_id", orders); err != nil {
+		t.Errorf("BuildIdMap : %v", err)
+	}
+	codes := Rows{{"zip": "007"}, {"zip": []byte("7")}}.IndexBy("zip")
+	if len(codes) != 2 || NormalizeKey("007") == NormalizeKey("7") {
+		t.Errorf("Codes with leading zeros collide : %v", codes)
+	}
+}
+
+type preloadQuestion struct {
+	ID         int64
+	SurveyID   int64
+	QuestionID int64 `db:"question_id"`
+}
+
+type preloadSurvey struct {
+	ID             int64
+	Name           string
+	Published      bool
+	Surveyquestion []preloadQuestion
+	Authuser       []*struct{ Code string }
+}
+
+func TestPgPreload(t *testing.T) {
+	var survey preloadSurvey
+	err := setValue(reflect.ValueOf(&survey).Elem(), AssRow{"id": int32(3), "name": []byte("poll"), "published": "true",
+		"surveyquestion": Rows{{"id": "7", "survey_id": int64(3), "question_id": int64(2)}}})
+	if err != nil || survey.ID != 3 || survey.Name != "poll" || !survey.Published || len(survey.Surveyquestion) != 1 || survey.Surveyquestion[0].ID != 7 {
+		t.Errorf("Struct not filled : %+v %v", survey, err)
+	}
+	if fields := structFields(reflect.TypeOf(preloadQuestion{})); fields[1].column != "survey_id" || fields[2].column != "question_id" {
+		t.Errorf("Fields not matched : %v", fields)
+	}
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	db.ImportSchema("survey.json")
+	defer db.ClearImportSchema("survey.json")
+	rows, err := db.Table("survey").GetPreloaded([]string{"*"}, "", []string{"id"}, "", "surveyquestion.question", "authuser")
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	for _, row := range rows {
+		if _, ok := row["surveyquestion"].(Rows); !ok {
+			t.Errorf("Children not nested : %v", row)
+		}
+	}
+	surveys := []preloadSurvey{{ID: 1}}
+	if err = db.Table("survey").PreloadStructs(&surveys, "surveyquestion", "authuser"); err != nil {
+		t.Errorf("Can't preload structs : %v", err)
+	}
+}
+
+func TestPgHooks(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	var events []QueryEvent
+	db.AddHook(Hook{
+		BeforeQuery: func(event *QueryEvent) error {
+			event.Query = strings.Replace(event.Query, "1 as one", "2 as one", 1)
+			return nil
+		},
+		AfterQuery: func(event *QueryEvent) {
+			events = append(events, *event)
+		},
+	})
+	rows, err := db.QueryAssociativeArray("SELECT 1 as one")
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if len(events) != 1 || rows[0].GetInt("one") != 2 {
+		t.Errorf("Hook not applied : %v", events)
+	}
+}
+
+func TestPgLogger(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	var buf bytes.Buffer
+	db.SetLogger(zerolog.New(&buf))
+	db.LogQueries = true
+	_, err := db.QueryAssociativeArray("SELECT 'secret' as s FROM test WHERE id = 42")
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	logged := buf.String()
+	if strings.Contains(logged, "secret") || !strings.Contains(logged, `"operation":"select"`) || !strings.Contains(logged, `"table":"test"`) {
+		t.Errorf("Unexpected log : %s", logged)
+	}
+}
+
+func TestPgSlowQuery(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	slow := make(chan SlowQuery, 10)
+	db.SlowQuery = SlowQueryOptions{Threshold: time.Nanosecond, Explain: true, Callback: func(q SlowQuery) {
+		slow <- q
+	}}
+	// beyond the plans being captured, slow queries are reported at once without plan
+	for i := 0; i < cap(explainSlots); i++ {
+		explainSlots <- struct{}{}
+	}
+	db.slowQuery(&QueryEvent{Query: "SELECT * FROM test", Duration: time.Second})
+	for i := 0; i < cap(explainSlots); i++ {
+		<-explainSlots
+	}
+	if q := <-slow; q.Plan != nil || q.PlanErr == nil {
+		t.Errorf("Plan captured beyond the limit : %v", q)
+	}
+	// a single connection, held by the transaction, must not block the plan capture
+	db.conn.SetMaxOpenConns(1)
+	err := db.WithTx(func(tx *Db) error {
+		_, err := tx.QueryAssociativeArray("SELECT * FROM test")
+		return err
+	})
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if q := <-slow; q.Plan != nil {
+		t.Errorf("Plan captured in a transaction : %v", q)
+	}
+	_, err = db.QueryAssociativeArray("SELECT * FROM test")
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	select {
+	case q := <-slow:
+		if q.Plan == nil || len(q.Plan.SeqScans) != 1 {
+			t.Errorf("Slow query not reported : %v", q)
+		}
+	case <-time.After(10 * time.Second):
+		t.Errorf("Slow query not reported")
+	}
+}
+
+func TestPgMetrics(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	changed := NewPrometheusMetrics()
+	changed.ObserveQuery(QueryMetric{Driver: "postgres", Operation: "select", Table: "test", Duration: time.Millisecond})
+	changed.Buckets = append(changed.Buckets, 30, 60)
+	changed.ObserveQuery(QueryMetric{Driver: "postgres", Operation: "select", Table: "test", Duration: time.Minute})
+	var out bytes.Buffer
+	if _, err := changed.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `sqldb_query_duration_seconds_bucket{driver="postgres",operation="select",table="test",le="+Inf"} 2`) {
+		t.Errorf("Histogram not kept on its first buckets :\n%s", out.String())
+	}
+	metrics := NewPrometheusMetrics()
+	metrics.AddPool("test", db)
+	db.SetMetrics(metrics)
+	db.QueryAssociativeArray("SELECT * FROM test")
+	db.QueryAssociativeArray("SELECT * FROM missing_table")
+	server := httptest.NewServer(metrics)
+	defer server.Close()
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	for _, expected := range []string{`sqldb_queries_total{driver="postgres",operation="select",table="test"} 1`, `sqldb_query_duration_seconds_bucket{driver="postgres",operation="select",table="missing_table",le="+Inf"} 1`, "sqldb_query_errors_total", `sqldb_pool_open_connections{pool="test"}`} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("Missing %s in :\n%s", expected, body)
+		}
+	}
+}
+
+func TestPgTracing(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	recorder := &SpanRecorder{}
+	db.SetTracer(recorder)
+	ctx, parent := recorder.Start(context.Background(), "handler", nil)
+	db.WithContext(ctx).QueryAssociativeArray("SELECT * FROM test WHERE name = 'secret'")
+	parent.End()
+	spans := recorder.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("Unexpected spans : %v", spans)
+	}
+	span := spans[1]
+	if span.Parent != spans[0] || span.Name != "select test" || span.Attributes["db.system"] != "postgresql" || span.Attributes["db.name"] != "test" || strings.Contains(span.Attributes["db.statement"], "secret") || span.Ended.IsZero() {
+		t.Errorf("Unexpected span : %v", span)
+	}
+}
+
+func TestPgOpenWithOptions(t *testing.T) {
+	_, err := OpenWithOptions("postgres", "host=127.0.0.1 port=1 user=test password=test dbname=test sslmode=disable", OpenOptions{PingAttempts: 2, PingBackoff: time.Millisecond})
+	if err == nil {
+		t.Errorf("Unreachable database opened")
+	}
+	db, err := OpenWithOptions("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable", OpenOptions{MaxOpenConns: 4, ConnMaxLifetime: time.Minute})
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer db.Close()
+	if db.Stats().MaxOpenConnections != 4 {
+		t.Errorf("Pool not configured : %v", db.Stats())
+	}
+	res := httptest.NewRecorder()
+	db.HealthHandler(time.Second).ServeHTTP(res, httptest.NewRequest("GET", "/ready", nil))
+	if res.Code != http.StatusOK {
+		t.Errorf("Unhealthy database : %s", res.Body.String())
+	}
+}
+
+func TestPgWithTx(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	if !IsTransient(&pq.Error{Code: "40001"}) || !IsTransient(&mysql.MySQLError{Number: 1213}) || IsTransient(&pq.Error{Code: "23505"}) {
+		t.Errorf("Transient errors misclassified")
+	}
+	db.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	attempts := 0
+	err := db.WithTx(func(tx *Db) error {
+		attempts++
+		if _, err := tx.Table("test").Insert(AssRow{"name": "rolled back"}); err != nil {
+			return err
+		}
+		if attempts < 2 {
+			return &pq.Error{Code: "40P01"}
+		}
+		return errors.New("abort")
+	})
+	if err == nil || err.Error() != "abort" {
+		fmt.Println(err)
+		return
+	}
+	if attempts != 2 {
+		t.Errorf("Deadlocked transaction not retried : %d attempts", attempts)
+	}
+	rows, _ := db.Table("test").GetAssociativeArray([]string{"id"}, "name = 'rolled back'", []string{}, "")
+	if len(rows) != 0 {
+		t.Errorf("Transaction not rolled back")
+	}
+	// a deferred constraint fails the commit, which is not retried whatever the policy
+	if _, err = db.exec(db.conn, "CREATE TABLE committest (code integer UNIQUE DEFERRABLE INITIALLY DEFERRED)"); err != nil {
+		t.Errorf("Can't create table : %s", err.Error())
+		return
+	}
+	defer db.exec(db.conn, "DROP TABLE committest")
+	db.Retry.Retryable = func(error) bool { return true }
+	attempts = 0
+	err = db.WithTx(func(tx *Db) error {
+		attempts++
+		_, err := tx.exec(tx.session(), "INSERT INTO committest VALUES (1), (1)")
+		return err
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("Failed commit retried : %d attempts, %v", attempts, err)
+	}
+}
+
+func TestPgReplicas(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	err := db.SetReplicas(ReplicaOptions{URLs: []string{"host=127.0.0.1 port=1 user=test password=test dbname=test sslmode=disable"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.WithContext(ReadYourWrites(context.Background())).pickReplica("SELECT 1") != nil || db.pickReplica("DELETE FROM test") != nil {
+		t.Errorf("Statement routed to a replica")
+	}
+	if db.pickReplica("SELECT 1") == nil {
+		t.Errorf("Select not routed to a replica")
+	}
+	// the unreachable replica is ejected and the select answered by the primary
+	_, err = db.QueryAssociativeArray("SELECT 1 as one")
+	if db.pickReplica("SELECT 1") != nil {
+		t.Errorf("Unhealthy replica not ejected")
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+func TestPgCache(t *testing.T) {
+	if _, tables := cacheKey("SELECT * FROM a x, public.b AS y, c JOIN d ON d.id = c.d_id", nil); strings.Join(tables, ",") != "a,b,c,d" {
+		t.Errorf("Tables not read : %v", tables)
+	}
+	if operation, table := statementInfo("WITH gone AS (DELETE FROM a WHERE id = 1 RETURNING *) SELECT * FROM gone"); operation != "delete" || table != "a" {
+		t.Errorf("Data modifying CTE not a write : %s %s", operation, table)
+	}
+	if tables := writtenTables("WITH moved AS (DELETE FROM a RETURNING *) INSERT INTO b SELECT * FROM moved"); strings.Join(tables, ",") != "a,b" {
+		t.Errorf("Written tables not read : %v", tables)
+	}
+	if operation, _ := statementInfo("WITH x AS (SELECT 'update t set' as s) SELECT * FROM x FOR UPDATE"); operation != "select" {
+		t.Errorf("Select read as a write : %s", operation)
+	}
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	cache := NewLRUCache(10)
+	db.SetCache(CacheOptions{Backend: cache, TTL: time.Minute})
+	// a write during the select leaves its result out of the cache
+	stale, _ := db.cachedQuery("SELECT * FROM raced", func() (*OrderedRows, error) {
+		db.cache.invalidate("raced")
+		return &OrderedRows{}, nil
+	})
+	if stale == nil || cache.Len() != 0 {
+		t.Errorf("Raced select cached")
+	}
+	db.cachedQuery("SELECT nextval('sq_test')", func() (*OrderedRows, error) {
+		return &OrderedRows{}, nil
+	})
+	if cache.Len() != 0 {
+		t.Errorf("Select of no table cached")
+	}
+	other := Open("postgres", "host=127.0.0.1 port=5432 user=other password=test dbname=test sslmode=disable")
+	defer other.Close()
+	other.SetCache(CacheOptions{Backend: cache})
+	if db.cache.identity == other.cache.identity {
+		t.Errorf("Databases sharing a cache identity")
+	}
+	selects := 0
+	db.AddHook(Hook{BeforeQuery: func(event *QueryEvent) error {
+		if strings.HasPrefix(event.Query, "select") {
+			selects++
+		}
+		return nil
+	}})
+	rows, err := db.Table("test").GetAssociativeArray([]string{"*"}, "", []string{}, "")
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	again, _ := db.Table("test").GetAssociativeArray([]string{"*"}, "", []string{}, "")
+	if selects != 1 || len(again) != len(rows) {
+		t.Errorf("Select not cached : %d selects", selects)
+	}
+	db.Table("test").Insert(AssRow{"name": "cached"})
+	again, _ = db.Table("test").GetAssociativeArray([]string{"*"}, "", []string{}, "")
+	if selects != 2 || len(again) != len(rows)+1 {
+		t.Errorf("Cache not invalidated by insert : %d selects", selects)
+	}
+}
+
+func TestPgSchemaCache(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	schemaQueries := 0
+	db.AddHook(Hook{BeforeQuery: func(event *QueryEvent) error {
+		if strings.Contains(event.Query, "INFORMATION_SCHEMA.COLUMNS") {
+			schemaQueries++
+		}
+		return nil
+	}})
+	if err := db.PreloadSchema(); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	schemaQueries = 0
+	db.Table("test").Insert(AssRow{"name": "schema1"})
+	db.Table("test").Insert(AssRow{"name": "schema2"})
+	if schemaQueries != 0 {
+		t.Errorf("Schema not cached : %d schema queries", schemaQueries)
+	}
+	db.Table("test").AddColumn("cached", "integer", "")
+	defer db.Table("test").DeleteColumn("cached")
+	schema, err := db.Table("test").GetSchema()
+	if err != nil {
+		t.Errorf("Can't get schema : %s", err.Error())
+		return
+	}
+	if _, ok := schema.Columns["cached"]; !ok || schemaQueries != 1 {
+		t.Errorf("Schema not invalidated by add column : %d schema queries", schemaQueries)
+	}
+}
+
+func TestPgStatementCache(t *testing.T) {
+	if statementArg("postgres", "integer", "") != nil || statementArg("postgres", "jsonb", map[string]int{"a": 1}) != `{"a":1}` || statementArg("postgres", "integer", "12") != int64(12) {
+		t.Errorf("Wrong statement arguments")
+	}
+	if statementArg("mysql", "tinyint(1)", "true") != int64(1) || statementArg("mysql", "tinyint(1)", false) != int64(0) || statementArg("mysql", "tinyint(4)", "3") != int64(3) {
+		t.Errorf("Wrong mysql boolean arguments")
+	}
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	if db.placeholder(2) != "$2" {
+		t.Errorf("Wrong placeholder")
+	}
+	db.SetStatementCache(2)
+	id, err := db.Table("test").Insert(AssRow{"name": "prepared1"})
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	db.Table("test").Insert(AssRow{"name": "prepared2"})
+	if db.statements.Len() != 1 {
+		t.Errorf("Insert statement not shared : %d statements", db.statements.Len())
+	}
+	err = db.WithTx(func(tx *Db) error {
+		return tx.Table("test").Update(AssRow{"id": id, "name": "prepared3"})
+	})
+	if err != nil {
+		t.Errorf("Can't update in transaction : %s", err.Error())
+	}
+	rows, err := db.Table("test").GetAssociativeArray([]string{"name"}, "id = "+strconv.FormatInt(id, 10), []string{}, "")
+	if err != nil || len(rows) != 1 || rows[0]["name"] != "prepared3" {
+		t.Errorf("Update not applied : %v %v", rows, err)
+	}
+	// selects are kept apart, they don't evict the other statements
+	if db.statements.Len() != 2 || db.selects.Len() != 1 {
+		t.Errorf("Select not prepared apart : %d statements, %d selects", db.statements.Len(), db.selects.Len())
+	}
+	db.Table("test").Delete(AssRow{"id": id})
+	if db.statements.Len() != 2 {
+		t.Errorf("Statement cache not bounded : %d statements", db.statements.Len())
+	}
+	db.Table("test").AddColumn("prepared", "integer", "")
+	db.Table("test").DeleteColumn("prepared")
+	if db.statements.Len() != 0 || db.selects.Len() != 0 {
+		t.Errorf("Statements not invalidated by DDL : %d statements", db.statements.Len())
+	}
+}
+
+func TestPgSchemas(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	if name := db.InSchema("tenant").Table("test").qualifiedName(); name != "tenant.test" {
+		t.Errorf("Wrong qualified name : %s", name)
+	}
+	if _, err := db.InSchema("x; drop table test").Table("test").Insert(AssRow{"name": "a"}); !errors.Is(err, ErrInvalidSchema) {
+		t.Errorf("Invalid schema used : %v", err)
+	}
+	if err := db.CreateSchema("sqldb_schema"); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer db.DropSchema("sqldb_schema")
+	schema := db.InSchema("sqldb_schema")
+	err := schema.CreateTable(TableInfo{Name: "test", Columns: map[string]string{"id": "integer", "label": "varchar(20)|label"}})
+	if err != nil {
+		t.Errorf("Can't create table in schema : %s", err.Error())
+		return
+	}
+	schemas, _ := db.ListSchemas()
+	found := false
+	for _, name := range schemas {
+		found = found || name == "sqldb_schema"
+	}
+	if !found {
+		t.Errorf("Schema not listed : %v", schemas)
+	}
+	ti, err := schema.Table("test").GetSchema()
+	if err != nil || len(ti.Columns) != 2 || ti.Columns["label"] != "varchar(20)|label" {
+		t.Errorf("Wrong table in schema : %v %v", ti, err)
+	}
+	tables, _ := schema.ListTables()
+	if len(tables) != 1 {
+		t.Errorf("Tables of other schemas listed : %v", tables)
+	}
+	schema.Table("test").Insert(AssRow{"label": "in schema"})
+	rows, _ := schema.Table("test").GetAssociativeArray([]string{"label"}, "", []string{}, "")
+	if len(rows) != 1 {
+		t.Errorf("Wrong rows in schema : %v", rows)
+	}
+	var buf bytes.Buffer
+	schema.Dump(&buf, DumpOptions{DropTables: true})
+	for _, expected := range []string{"DROP TABLE IF EXISTS sqldb_schema.test;", "INSERT INTO sqldb_schema.test (", "setval(pg_get_serial_sequence('sqldb_schema.test'"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Missing %s in dump :\n%s", expected, buf.String())
+		}
+	}
+}
+
+func TestPgTenants(t *testing.T) {
+	db := Open("postgres", "host=127.0.0.1 port=5432 user=test password=test dbname=test sslmode=disable")
+	defer db.Close()
+	if err := db.SetTenantPrefix("x; drop table test; "); !errors.Is(err, ErrInvalidSchema) {
+		t.Errorf("Invalid tenant prefix accepted")
+	}
+	db.SetTenantPrefix("sqldb_tenant_")
+	if _, err := db.ForTenant(context.Background()); err != ErrNoTenant {
+		t.Errorf("Tenant found in empty context")
+	}
+	if _, err := db.ForTenant(WithTenant(context.Background(), "a; drop table test")); !errors.Is(err, ErrInvalidTenant) {
+		t.Errorf("Invalid tenant accepted")
+	}
+	if err := db.CreateSchema("a; drop table test"); !errors.Is(err, ErrInvalidSchema) {
+		t.Errorf("Invalid schema accepted")
+	}
+	if err := db.InSchema("a; drop table test").WithTx(func(*Db) error { return nil }); !errors.Is(err, ErrInvalidSchema) {
+		t.Errorf("Invalid search_path accepted : %v", err)
+	}
+	for _, tenant := range []string{"one", "two"} {
+		if err := db.ProvisionTenant(tenant, "pfn.json"); err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer db.DropTenant(tenant)
+	}
+	tenants, _ := db.ListTenants()
+	if len(tenants) != 2 || tenants[0] != "one" {
+		t.Errorf("Wrong tenants : %v", tenants)
+	}
+	var progress []MigrationProgress
+	err := db.MigrateTenants(MigrateOptions{Concurrency: 2, Progress: func(p MigrationProgress) {
+		progress = append(progress, p)
+	}}, func(tenant *Db) error {
+		// unqualified, found through the search_path
+		_, err := tenant.exec(tenant.session(), "ALTER TABLE computer ADD migrated integer")
+		return err
+	})
+	if err != nil || len(progress) != 2 || progress[1].Done != 2 || progress[1].Total != 2 {
+		t.Errorf("Migration failed : %v %v", err, progress)
+	}
+	two, err := db.ForTenant(WithTenant(context.Background(), "two"))
+	if err != nil {
+		t.Errorf("Can't get tenant : %s", err.Error())
+		return
+	}
+	ti, _ := two.Table("computer").GetSchema()
+	if _, ok := ti.Columns["migrated"]; !ok {
+		t.Errorf("Tenant not migrated : %v", ti.Columns)
+	}
+	// a raw query outside of a transaction finds the table of the tenant
+	if _, err = two.QueryAssociativeArray("SELECT migrated FROM computer"); err != nil {
+		t.Errorf("Raw query not in the tenant schema : %s", err.Error())
+	}
+}
@@ -0,0 +1,91 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// OpenOptions : connection pool settings and connection checks of OpenWithOptions, zero values keep the driver defaults
+type OpenOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int // negative to keep no idle connection
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	PingAttempts    int           // 1 by default
+	PingBackoff     time.Duration // wait before the second attempt, doubled at each attempt, 500ms by default
+	PingTimeout     time.Duration // timeout of each attempt, 5s by default
+}
+
+// OpenWithOptions : Open the database, configure its connection pool and check it answers
+func OpenWithOptions(driver string, url string, opts OpenOptions) (*Db, error) {
+	conn, err := sql.Open(driver, url)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxOpenConns != 0 {
+		conn.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+	if opts.MaxIdleConns != 0 {
+		conn.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	if opts.ConnMaxLifetime != 0 {
+		conn.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
+	if opts.ConnMaxIdleTime != 0 {
+		conn.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	}
+	if opts.PingAttempts <= 0 {
+		opts.PingAttempts = 1
+	}
+	if opts.PingBackoff <= 0 {
+		opts.PingBackoff = 500 * time.Millisecond
+	}
+	if opts.PingTimeout <= 0 {
+		opts.PingTimeout = 5 * time.Second
+	}
+	db := &Db{Driver: driver, Url: url, conn: conn}
+	backoff := opts.PingBackoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), opts.PingTimeout)
+		err = conn.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return db, nil
+		}
+		if attempt >= opts.PingAttempts {
+			break
+		}
+		db.Logger().Warn().Err(err).Str("driver", driver).Int("attempt", attempt).Msg("ping")
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	conn.Close()
+	return nil, fmt.Errorf("ping %s database after %d attempts: %w", driver, opts.PingAttempts, err)
+}
+
+// Health : Check the database answers a trivial query, for readiness probes
+func (db *Db) Health(ctx context.Context) error {
+	if err := db.conn.PingContext(ctx); err != nil {
+		return err
+	}
+	var one int64
+	return db.WithContext(ctx).queryRow(db.conn, "SELECT 1", nil, &one)
+}
+
+// HealthHandler : Serve the health of the database, 200 when it answers within the timeout, 503 otherwise
+func (db *Db) HealthHandler(timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := db.Health(ctx); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, ErrorClass(err))
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
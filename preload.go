@@ -0,0 +1,358 @@
+package sqldb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// preloadBatchSize : keys looked up by each IN (...) query
+const preloadBatchSize = 500
+
+// Relation : a relationship of a table to another, derived from a foreign key or the <table>_id naming convention
+type Relation struct {
+	Name          string // key the related rows are nested under
+	Table         string // related table
+	Column        string // column of the table holding the key
+	RelatedColumn string // column of the related table matching the key
+	Many          bool   // children referencing the table, nested as Rows, otherwise the referenced parent, nested as an AssRow
+}
+
+// Relations : Provide the relationships of a table.
+// A parent is named after the referencing column without its _id suffix,
+// children are named after their table, or <table>_<column> when the table references this one more than once
+func (t *TableInfo) Relations() ([]Relation, error) {
+	links, err := t.db.links()
+	if err != nil {
+		return nil, err
+	}
+	return t.relations(links), nil
+}
+
+// links : links between all the tables of the database
+func (db *Db) links() ([]Link, error) {
+	schema, err := db.GetSchema()
+	if err != nil {
+		return nil, err
+	}
+	return db.schemaLinks(schema)
+}
+
+// relations : relationships of the table among the links of the database
+func (t *TableInfo) relations(links []Link) []Relation {
+	children := make(map[string]int)
+	for _, link := range links {
+		if link.Destination == t.Name {
+			children[link.Source]++
+		}
+	}
+	var relations []Relation
+	for _, link := range links {
+		if link.Source == t.Name {
+			relations = append(relations, Relation{
+				Name:          strings.TrimSuffix(link.SourceColumn, "_id"),
+				Table:         link.Destination,
+				Column:        link.SourceColumn,
+				RelatedColumn: link.DestinationColumn,
+			})
+		}
+		if link.Destination == t.Name {
+			name := link.Source
+			if children[link.Source] > 1 {
+				name += "_" + strings.TrimSuffix(link.SourceColumn, "_id")
+			}
+			relations = append(relations, Relation{
+				Name:          name,
+				Table:         link.Source,
+				Column:        link.DestinationColumn,
+				RelatedColumn: link.SourceColumn,
+				Many:          true,
+			})
+		}
+	}
+	return relations
+}
+
+// Preload : Load the related rows of rows read from the table and nest them into each row under the relation name.
+// Nested relations are given as paths, as "surveyquestion.question", each relation is loaded once with batched IN (...) queries
+func (t *TableInfo) Preload(rows Rows, relations ...string) error {
+	if len(rows) == 0 || len(relations) == 0 {
+		return nil
+	}
+	// the schema and its links are read once for every level
+	links, err := t.db.links()
+	if err != nil {
+		return err
+	}
+	return t.preload(rows, relations, links)
+}
+
+// preload : Preload relations given the links of the database
+func (t *TableInfo) preload(rows Rows, relations []string, links []Link) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	// group the paths by their first relation, so each relation is loaded once
+	paths := make(map[string][]string)
+	var names []string
+	for _, relation := range relations {
+		parts := strings.SplitN(relation, ".", 2)
+		if _, ok := paths[parts[0]]; !ok {
+			names = append(names, parts[0])
+			paths[parts[0]] = nil
+		}
+		if len(parts) > 1 {
+			paths[parts[0]] = append(paths[parts[0]], parts[1])
+		}
+	}
+	available := t.relations(links)
+	for _, name := range names {
+		var rel *Relation
+		for i := range available {
+			if available[i].Name == name {
+				rel = &available[i]
+				break
+			}
+		}
+		if rel == nil {
+			return fmt.Errorf("no relation %s on table %s", name, t.Name)
+		}
+		related, err := t.preloadRelation(rows, *rel)
+		if err != nil {
+			return err
+		}
+		if len(paths[name]) > 0 {
+			err = t.db.Table(rel.Table).preload(related, paths[name], links)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// preloadRelation : Load and nest one relation, provide the loaded rows
+func (t *TableInfo) preloadRelation(rows Rows, rel Relation) (Rows, error) {
+	if _, ok := rows[0][rel.Column]; !ok {
+		return nil, fmt.Errorf("column %s of table %s is required to load %s", rel.Column, t.Name, rel.Name)
+	}
+	seen := make(map[interface{}]bool)
+	var keys []interface{}
+	for _, row := range rows {
+		key := NormalizeKey(row[rel.Column])
+		if key != nil && !seen[key] {
+			seen[key] = true
+			keys = append(keys, row[rel.Column])
+		}
+	}
+	var related Rows
+	for start := 0; start < len(keys); start += preloadBatchSize {
+		end := start + preloadBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		literals := make([]string, end-start)
+		for i, key := range keys[start:end] {
+			literals[i] = t.db.sqlLiteral(key)
+		}
+		restriction := rel.RelatedColumn + " IN (" + strings.Join(literals, ",") + ")"
+		sortkeys := []string{}
+		if rel.Many {
+			sortkeys = []string{rel.RelatedColumn}
+		}
+		batch, err := t.db.selectRows(t.db.Table(rel.Table).buildSelect("", []string{"*"}, restriction, sortkeys))
+		if err != nil {
+			return nil, err
+		}
+		related = append(related, batch...)
+	}
+	if rel.Many {
+		groups := make(map[interface{}]Rows)
+		for _, child := range related {
+			key := NormalizeKey(child[rel.RelatedColumn])
+			groups[key] = append(groups[key], child)
+		}
+		for _, row := range rows {
+			children := groups[NormalizeKey(row[rel.Column])]
+			if children == nil {
+				children = Rows{}
+			}
+			row[rel.Name] = children
+		}
+		return related, nil
+	}
+	parents := related.IndexBy(rel.RelatedColumn)
+	for _, row := range rows {
+		if parent, ok := parents[NormalizeKey(row[rel.Column])]; ok {
+			row[rel.Name] = parent
+		} else {
+			row[rel.Name] = nil
+		}
+	}
+	return related, nil
+}
+
+// GetPreloaded : Provide table data as an associative array, with related rows nested, see Preload
+func (t *TableInfo) GetPreloaded(columns []string, restriction string, sortkeys []string, dir string, relations ...string) (Rows, error) {
+	rows, err := t.GetAssociativeArray(columns, restriction, sortkeys, dir)
+	if err != nil {
+		return nil, err
+	}
+	err = t.Preload(rows, relations...)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// PreloadStructs : Preload relations into structs read from the table, dest being a pointer to a slice of structs or of struct pointers.
+// Fields match columns and relations by their db tag, or by their name in snake case, SurveyID for survey_id.
+// A parent relation fills a struct or struct pointer field, children fill a slice field
+func (t *TableInfo) PreloadStructs(dest interface{}, relations ...string) error {
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("preload: %T is not a pointer to a slice", dest)
+	}
+	slice = slice.Elem()
+	rows := make(Rows, slice.Len())
+	for i := range rows {
+		item := reflect.Indirect(slice.Index(i))
+		if item.Kind() != reflect.Struct {
+			return fmt.Errorf("preload: %s is not a struct", item.Type())
+		}
+		rows[i] = structRow(item)
+	}
+	if err := t.Preload(rows, relations...); err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for _, relation := range relations {
+		names[strings.SplitN(relation, ".", 2)[0]] = true
+	}
+	for i, row := range rows {
+		item := reflect.Indirect(slice.Index(i))
+		for _, field := range structFields(item.Type()) {
+			if !names[field.column] {
+				continue
+			}
+			if err := setValue(item.Field(field.index), row[field.column]); err != nil {
+				return fmt.Errorf("preload %s: %w", field.column, err)
+			}
+		}
+	}
+	return nil
+}
+
+// structField : exported field of a struct and the column it matches
+type structField struct {
+	index  int
+	column string
+}
+
+// structFields : Provide the fields of a struct type matching columns
+func structFields(typ reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		column := strings.Split(field.Tag.Get("db"), ",")[0]
+		if column == "-" {
+			continue
+		}
+		if column == "" {
+			column = snakeCase(field.Name)
+		}
+		fields = append(fields, structField{index: i, column: column})
+	}
+	return fields
+}
+
+// structRow : row of the fields of a struct
+func structRow(item reflect.Value) AssRow {
+	row := make(AssRow)
+	for _, field := range structFields(item.Type()) {
+		row[field.column] = item.Field(field.index).Interface()
+	}
+	return row
+}
+
+// setValue : Set a field from a value read from the database, nested rows fill structs and slices
+func setValue(field reflect.Value, value interface{}) error {
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	if field.Kind() == reflect.Ptr {
+		elem := reflect.New(field.Type().Elem())
+		if err := setValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+	switch v := value.(type) {
+	case AssRow:
+		if field.Kind() != reflect.Struct {
+			return fmt.Errorf("can't set a row into %s", field.Type())
+		}
+		for _, f := range structFields(field.Type()) {
+			if err := setValue(field.Field(f.index), v[f.column]); err != nil {
+				return fmt.Errorf("%s: %w", f.column, err)
+			}
+		}
+		return nil
+	case Rows:
+		if field.Kind() != reflect.Slice {
+			return fmt.Errorf("can't set rows into %s", field.Type())
+		}
+		slice := reflect.MakeSlice(field.Type(), len(v), len(v))
+		for i, row := range v {
+			if err := setValue(slice.Index(i), row); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	if reflect.TypeOf(value).AssignableTo(field.Type()) {
+		field.Set(reflect.ValueOf(value))
+		return nil
+	}
+	// same conversions as the typed accessors of AssRow
+	strict := StrictRow{lookup: func(string) (interface{}, bool) { return value, true }}
+	var err error
+	switch field.Kind() {
+	case reflect.String:
+		var str string
+		str, err = strict.String("")
+		field.SetString(str)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		i, err = strict.Int64("")
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		u, err = strict.Uint64("")
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strict.Float64("")
+		field.SetFloat(f)
+	case reflect.Bool:
+		var b bool
+		b, err = strict.Bool("")
+		field.SetBool(b)
+	default:
+		if field.Type() == reflect.TypeOf(time.Time{}) {
+			var tm time.Time
+			tm, err = strict.Time("")
+			field.Set(reflect.ValueOf(tm))
+		} else {
+			err = fmt.Errorf("can't set %T into %s", value, field.Type())
+		}
+	}
+	return err
+}
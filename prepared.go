@@ -0,0 +1,355 @@
+package sqldb
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// stmtCache : prepared statements shared by the views of a database, least recently used first evicted
+type stmtCache struct {
+	mutex   sync.Mutex
+	size    int
+	entries map[stmtKey]*list.Element
+	order   *list.List // most recently used first
+}
+
+// stmtKey : a statement is prepared once per connection pool, the primary and each replica
+type stmtKey struct {
+	conn  *sql.DB
+	query string
+}
+
+type stmtEntry struct {
+	key     stmtKey
+	stmt    *sql.Stmt
+	refs    int  // statements running
+	evicted bool // closed when no longer running
+}
+
+// SetStatementCache : Prepare the statements of Insert, Update, Delete and GetAssociativeArray once and keep at most size of them.
+// Insert, Update and Delete then send their values as arguments. The selects of GetAssociativeArray inline their restriction,
+// so they are kept apart, up to size of them too, not to evict the others. Zero disables the cache and closes its statements
+func (db *Db) SetStatementCache(size int) {
+	db.ClearStatements()
+	if size <= 0 {
+		db.statements, db.selects = nil, nil
+		return
+	}
+	db.statements = newStmtCache(size)
+	db.selects = newStmtCache(size)
+}
+
+// newStmtCache : Create a cache of at most size statements
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{size: size, entries: make(map[stmtKey]*list.Element), order: list.New()}
+}
+
+// ClearStatements : Close the cached prepared statements, done by the package after DDL statements
+func (db *Db) ClearStatements() {
+	if db.statements != nil {
+		db.statements.clear()
+	}
+	if db.selects != nil {
+		db.selects.clear()
+	}
+}
+
+// invalidateStatements : Close the prepared statements after a DDL statement, their plans may no longer apply
+func (db *Db) invalidateStatements(event *QueryEvent) {
+	if event.Err != nil {
+		return
+	}
+	if operation, _ := statementInfo(event.Query); operation == "ddl" {
+		db.ClearStatements()
+	}
+}
+
+// preparedQueryer : queryer running a statement prepared through the cache, other statements run as usual
+type preparedQueryer struct {
+	cache *stmtCache
+	q     queryer
+	conn  *sql.DB
+	tx    *sql.Tx
+	query string
+}
+
+// prepared : Provide what runs a statement prepared through the cache, q itself when the cache is disabled
+func (db *Db) prepared(q queryer, query string) queryer {
+	return db.preparedIn(db.statements, q, query)
+}
+
+// preparedIn : Provide what runs a statement prepared through a cache, q itself when it is nil
+func (db *Db) preparedIn(cache *stmtCache, q queryer, query string) queryer {
+	if cache == nil {
+		return q
+	}
+	p := &preparedQueryer{cache: cache, q: q, query: query}
+	switch q := q.(type) {
+	case *sql.DB:
+		p.conn = q
+	case *sql.Tx:
+		// statements are prepared on the pool, then bound to the transaction
+		p.conn, p.tx = db.conn, q
+	default:
+		return q
+	}
+	return p
+}
+
+// statement : Provide the prepared statement of a query, bound to the transaction if any, with its release function
+func (p *preparedQueryer) statement(ctx context.Context, query string) (*sql.Stmt, func(), error) {
+	if query != p.query {
+		// rewritten by a hook
+		return nil, nil, nil
+	}
+	entry, err := p.cache.acquire(ctx, stmtKey{conn: p.conn, query: query})
+	if err != nil {
+		return nil, nil, err
+	}
+	release := func() { p.cache.release(entry) }
+	if p.tx == nil {
+		return entry.stmt, release, nil
+	}
+	// closed with the transaction
+	return p.tx.StmtContext(ctx, entry.stmt), release, nil
+}
+
+func (p *preparedQueryer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	stmt, release, err := p.statement(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return p.q.ExecContext(ctx, query, args...)
+	}
+	defer release()
+	return stmt.ExecContext(ctx, args...)
+}
+
+func (p *preparedQueryer) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	stmt, release, err := p.statement(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return p.q.QueryContext(ctx, query, args...)
+	}
+	// rows keep their statement open until closed
+	defer release()
+	return stmt.QueryContext(ctx, args...)
+}
+
+func (p *preparedQueryer) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	stmt, release, err := p.statement(ctx, query)
+	if err != nil || stmt == nil {
+		// a failed preparation fails again, reporting its error through the row
+		return p.q.QueryRowContext(ctx, query, args...)
+	}
+	defer release()
+	return stmt.QueryRowContext(ctx, args...)
+}
+
+// acquire : Provide the cached statement of a query, prepared if need be, to be released after use
+func (c *stmtCache) acquire(ctx context.Context, key stmtKey) (*stmtEntry, error) {
+	c.mutex.Lock()
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		entry := element.Value.(*stmtEntry)
+		entry.refs++
+		c.mutex.Unlock()
+		return entry, nil
+	}
+	c.mutex.Unlock()
+	stmt, err := key.conn.PrepareContext(ctx, key.query)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		// prepared meanwhile by another goroutine
+		stmt.Close()
+		c.order.MoveToFront(element)
+		entry := element.Value.(*stmtEntry)
+		entry.refs++
+		return entry, nil
+	}
+	entry := &stmtEntry{key: key, stmt: stmt, refs: 1}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		c.evict(c.order.Back())
+	}
+	return entry, nil
+}
+
+// release : Account the end of a statement run, closing it when evicted meanwhile
+func (c *stmtCache) release(entry *stmtEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry.refs--
+	if entry.evicted && entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+// clear : Evict every statement
+func (c *stmtCache) clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for c.order.Len() > 0 {
+		c.evict(c.order.Back())
+	}
+}
+
+// evict : Remove a statement from the cache, closing it unless running
+func (c *stmtCache) evict(element *list.Element) {
+	entry := element.Value.(*stmtEntry)
+	c.order.Remove(element)
+	delete(c.entries, entry.key)
+	entry.evicted = true
+	if entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+// Len : number of cached statements
+func (c *stmtCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+// placeholder : parameter marker of the driver for the argument at position i, from 1
+func (db *Db) placeholder(i int) string {
+	switch db.Driver {
+	case "postgres":
+		return "$" + strconv.Itoa(i)
+	case "sqlserver":
+		return "@p" + strconv.Itoa(i)
+	}
+	return "?"
+}
+
+// statementArg : argument of a value for a column, as FormatForSQL would write it, maps and slices in JSON.
+// Text is converted to the type of the column, as the database would read the literal, and mysql booleans are sent as 0 or 1
+func statementArg(driverName string, datatype string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	if _, ok := value.(driver.Valuer); ok {
+		return value
+	}
+	if kind := reflect.ValueOf(value).Kind(); kind == reflect.Map || kind == reflect.Slice && !isBytes(value) {
+		if b, err := json.Marshal(value); err == nil {
+			return string(b)
+		}
+	}
+	strval := fmt.Sprintf("%v", value)
+	if strings.Contains(datatype, "char") || strings.Contains(datatype, "text") {
+		return strval
+	}
+	if len(strval) == 0 {
+		return nil
+	}
+	base, args, _ := splitType(datatype)
+	generic, known := genericType(driverName, base, args)
+	if str, ok := value.(string); ok && known && generic != "binary" && generic != "json" {
+		// left as is when not of the type, for the database to report it
+		if coerced, err := coerceValue(driverName, datatype, str); err == nil {
+			value = coerced
+		}
+	}
+	if b, ok := value.(bool); ok && generic == "boolean" && driverName == "mysql" {
+		if b {
+			return int64(1)
+		}
+		return int64(0)
+	}
+	if arg, err := driver.DefaultParameterConverter.ConvertValue(value); err == nil {
+		return arg
+	}
+	return strval
+}
+
+func isBytes(value interface{}) bool {
+	_, ok := value.([]byte)
+	return ok
+}
+
+// sortedColumns : columns of a record in a stable order, so their statements are shared
+func sortedColumns(record AssRow) []string {
+	columns := make([]string, 0, len(record))
+	for key := range record {
+		columns = append(columns, key)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// preparedInsert : Insert through a prepared statement
+func (t *TableInfo) preparedInsert(record AssRow) (int64, error) {
+	var id int64
+	columns := sortedColumns(record)
+	markers := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, key := range columns {
+		markers[i] = t.db.placeholder(i + 1)
+		args[i] = statementArg(t.db.Driver, t.Columns[key], record[key])
+	}
+	query := "INSERT INTO " + t.qualifiedName() + "(" + strings.Join(columns, ",") + ") VALUES (" + strings.Join(markers, ",") + ")"
+	if t.db.Driver == "postgres" {
+		query += " RETURNING id"
+		err := t.db.queryRow(t.db.prepared(t.db.session(), query), query, args, &id)
+		return id, err
+	}
+	if t.db.Driver == "mysql" {
+		res, err := t.db.exec(t.db.prepared(t.db.session(), query), query, args...)
+		if err != nil {
+			return id, err
+		}
+		return res.LastInsertId()
+	}
+	return id, nil
+}
+
+// preparedUpdate : Update through a prepared statement
+func (t *TableInfo) preparedUpdate(record AssRow) error {
+	id, ok := record["id"]
+	if !ok {
+		return errors.New("update: no id")
+	}
+	var set []string
+	var args []interface{}
+	for _, key := range sortedColumns(record) {
+		if key == "id" {
+			continue
+		}
+		args = append(args, statementArg(t.db.Driver, t.Columns[key], record[key]))
+		set = append(set, key+" = "+t.db.placeholder(len(args)))
+	}
+	args = append(args, id)
+	query := "UPDATE " + t.qualifiedName() + " SET " + strings.Join(set, ", ") + " WHERE id = " + t.db.placeholder(len(args))
+	_, err := t.db.exec(t.db.prepared(t.db.session(), query), query, args...)
+	return err
+}
+
+// preparedDelete : Delete through a prepared statement
+func (t *TableInfo) preparedDelete(record AssRow) error {
+	id, ok := record["id"]
+	if !ok {
+		return errors.New("delete: no id")
+	}
+	query := "DELETE FROM " + t.qualifiedName() + " WHERE id = " + t.db.placeholder(1)
+	_, err := t.db.exec(t.db.prepared(t.db.session(), query), query, id)
+	return err
+}
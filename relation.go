@@ -0,0 +1,156 @@
+package sqldb
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// ForeignKey is a foreign key constraint declared in the database
+type ForeignKey struct {
+	Table            string `json:"table"`
+	Column           string `json:"column"`
+	ReferencedTable  string `json:"referenced_table"`
+	ReferencedColumn string `json:"referenced_column"`
+}
+
+// ForeignKeys : Provide the foreign key constraints of the database
+func (db *Db) ForeignKeys() ([]ForeignKey, error) {
+	var query string
+	switch db.Driver {
+	case "postgres":
+		query = "SELECT kcu.table_name :: varchar as tbl, kcu.column_name :: varchar as col, ccu.table_name :: varchar as reftbl, ccu.column_name :: varchar as refcol FROM information_schema.table_constraints tc JOIN information_schema.key_column_usage kcu ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema JOIN information_schema.constraint_column_usage ccu ON ccu.constraint_name = tc.constraint_name AND ccu.table_schema = tc.table_schema WHERE tc.constraint_type = 'FOREIGN KEY' AND " + db.schemaFilter("tc.table_schema", db.schema) + ";"
+	case "mysql":
+		query = "SELECT TABLE_NAME as tbl, COLUMN_NAME as col, REFERENCED_TABLE_NAME as reftbl, REFERENCED_COLUMN_NAME as refcol FROM information_schema.KEY_COLUMN_USAGE WHERE " + db.schemaFilter("TABLE_SCHEMA", db.schema) + " AND REFERENCED_TABLE_NAME IS NOT NULL;"
+	case "sqlserver":
+		query = "SELECT kcu.TABLE_NAME as tbl, kcu.COLUMN_NAME as col, ccu.TABLE_NAME as reftbl, ccu.COLUMN_NAME as refcol FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS tc JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE kcu ON tc.CONSTRAINT_NAME = kcu.CONSTRAINT_NAME AND tc.CONSTRAINT_SCHEMA = kcu.CONSTRAINT_SCHEMA JOIN INFORMATION_SCHEMA.CONSTRAINT_COLUMN_USAGE ccu ON ccu.CONSTRAINT_NAME = tc.CONSTRAINT_NAME AND ccu.CONSTRAINT_SCHEMA = tc.CONSTRAINT_SCHEMA WHERE tc.CONSTRAINT_TYPE = 'FOREIGN KEY' AND " + db.schemaFilter("tc.TABLE_SCHEMA", db.schema) + ";"
+	default:
+		return nil, errors.New("no driver")
+	}
+	rows, err := db.selectRows(query)
+	if err != nil {
+		return nil, err
+	}
+	var fks []ForeignKey
+	for _, row := range rows {
+		fks = append(fks, ForeignKey{
+			Table:            row.GetString("tbl"),
+			Column:           row.GetString("col"),
+			ReferencedTable:  row.GetString("reftbl"),
+			ReferencedColumn: row.GetString("refcol"),
+		})
+	}
+	return fks, nil
+}
+
+// schemaLinks : links between the tables of a schema, from the foreign key constraints
+// and from the <table>_id column naming convention
+func (db *Db) schemaLinks(schema []TableInfo) ([]Link, error) {
+	fks, err := db.ForeignKeys()
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string]bool)
+	for _, ti := range schema {
+		tables[ti.Name] = true
+	}
+	seen := make(map[string]bool)
+	var links []Link
+	add := func(link Link) {
+		key := link.Source + "." + link.SourceColumn
+		if seen[key] || !tables[link.Source] || !tables[link.Destination] {
+			return
+		}
+		seen[key] = true
+		links = append(links, link)
+	}
+	for _, fk := range fks {
+		add(Link{Source: fk.Table, Destination: fk.ReferencedTable, SourceColumn: fk.Column, DestinationColumn: fk.ReferencedColumn})
+	}
+	for _, link := range buildLinks(schema) {
+		add(link)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Source != links[j].Source {
+			return links[i].Source < links[j].Source
+		}
+		return links[i].SourceColumn < links[j].SourceColumn
+	})
+	return links, nil
+}
+
+// nullableColumns : nullability of the columns of every table, by table then column
+func (db *Db) nullableColumns() (map[string]map[string]bool, error) {
+	var query string
+	switch db.Driver {
+	case "postgres":
+		query = "SELECT table_name :: varchar as tbl, column_name :: varchar as name, is_nullable :: varchar as nullable FROM INFORMATION_SCHEMA.COLUMNS WHERE " + db.schemaFilter("table_schema", db.schema) + ";"
+	case "mysql":
+		query = "SELECT TABLE_NAME as tbl, COLUMN_NAME as name, IS_NULLABLE as nullable FROM INFORMATION_SCHEMA.COLUMNS WHERE " + db.schemaFilter("TABLE_SCHEMA", db.schema) + ";"
+	case "sqlserver":
+		query = "SELECT TABLE_NAME as tbl, COLUMN_NAME as name, IS_NULLABLE as nullable FROM INFORMATION_SCHEMA.COLUMNS WHERE " + db.schemaFilter("TABLE_SCHEMA", db.schema) + ";"
+	default:
+		return nil, errors.New("no driver")
+	}
+	rows, err := db.selectRows(query)
+	if err != nil {
+		return nil, err
+	}
+	nullable := make(map[string]map[string]bool)
+	for _, row := range rows {
+		table := row.GetString("tbl")
+		if nullable[table] == nil {
+			nullable[table] = make(map[string]bool)
+		}
+		nullable[table][row.GetString("name")] = strings.EqualFold(row.GetString("nullable"), "YES")
+	}
+	return nullable, nil
+}
+
+// Index is an index of a table, columns in index order
+type Index struct {
+	Table   string   `json:"table"`
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+	Primary bool     `json:"primary"`
+}
+
+// Indexes : Provide the indexes of the database tables
+func (db *Db) Indexes() ([]Index, error) {
+	var query string
+	switch db.Driver {
+	case "postgres":
+		query = "SELECT t.relname :: varchar as tbl, i.relname :: varchar as name, a.attname :: varchar as col, ix.indisunique as uniq, ix.indisprimary as prim FROM pg_class t JOIN pg_index ix ON t.oid = ix.indrelid JOIN pg_class i ON i.oid = ix.indexrelid JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = ANY(ix.indkey) JOIN pg_namespace n ON n.oid = t.relnamespace WHERE " + db.schemaFilter("n.nspname", db.schema) + " ORDER BY t.relname, i.relname, array_position(ix.indkey :: int2[], a.attnum);"
+	case "mysql":
+		query = "SELECT TABLE_NAME as tbl, INDEX_NAME as name, COLUMN_NAME as col, NON_UNIQUE = 0 as uniq, INDEX_NAME = 'PRIMARY' as prim FROM information_schema.STATISTICS WHERE " + db.schemaFilter("TABLE_SCHEMA", db.schema) + " ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX;"
+	case "sqlserver":
+		query = "SELECT t.name as tbl, i.name as name, c.name as col, i.is_unique as uniq, i.is_primary_key as prim FROM sys.indexes i JOIN sys.tables t ON i.object_id = t.object_id JOIN sys.index_columns ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id JOIN sys.columns c ON c.object_id = ic.object_id AND c.column_id = ic.column_id WHERE " + db.schemaFilter("SCHEMA_NAME(t.schema_id)", db.schema) + " ORDER BY t.name, i.name, ic.key_ordinal;"
+	default:
+		return nil, errors.New("no driver")
+	}
+	rows, err := db.selectRows(query)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []Index
+	for _, row := range rows {
+		table, name := row.GetString("tbl"), row.GetString("name")
+		last := len(indexes) - 1
+		if last < 0 || indexes[last].Table != table || indexes[last].Name != name {
+			indexes = append(indexes, Index{Table: table, Name: name, Unique: truthy(row["uniq"]), Primary: truthy(row["prim"])})
+			last++
+		}
+		indexes[last].Columns = append(indexes[last].Columns, row.GetString("col"))
+	}
+	return indexes, nil
+}
+
+// truthy : boolean value of a flag whatever its driver representation
+func truthy(value interface{}) bool {
+	if b, ok := value.(bool); ok {
+		return b
+	}
+	i, ok := toInt64(value)
+	return ok && i != 0
+}
@@ -0,0 +1,149 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Replica selection strategies
+const (
+	RoundRobin   = "round-robin"
+	LeastLatency = "least-latency"
+)
+
+// ReplicaOptions : read replicas of the database
+type ReplicaOptions struct {
+	URLs          []string
+	Strategy      string        // RoundRobin by default, or LeastLatency
+	EjectDuration time.Duration // time a replica failing on a connection error is left aside, 10s by default
+}
+
+// replicaSet : replicas shared by the views of a database
+type replicaSet struct {
+	mutex    sync.Mutex
+	strategy string
+	eject    time.Duration
+	replicas []*replica
+	next     int
+}
+
+type replica struct {
+	url          string
+	conn         *sql.DB
+	latency      time.Duration // moving average of the query latency
+	ejectedUntil time.Time
+}
+
+type readYourWritesKey struct{}
+
+// ReadYourWrites : Provide a context whose reads go to the primary, to see the writes just made
+func ReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, true)
+}
+
+// SetReplicas : Send the selects of QueryAssociativeArray, GetAssociativeArray and schema introspection to read replicas.
+// Writes and transactions stay on the primary, replicas failing on connection errors are ejected for a while
+func (db *Db) SetReplicas(opts ReplicaOptions) error {
+	set := &replicaSet{strategy: opts.Strategy, eject: opts.EjectDuration}
+	if set.strategy == "" {
+		set.strategy = RoundRobin
+	}
+	if set.eject <= 0 {
+		set.eject = 10 * time.Second
+	}
+	for _, url := range opts.URLs {
+		conn, err := sql.Open(db.Driver, url)
+		if err != nil {
+			set.close()
+			return err
+		}
+		set.replicas = append(set.replicas, &replica{url: url, conn: conn})
+	}
+	if db.replicas != nil {
+		db.replicas.close()
+	}
+	db.replicas = set
+	return nil
+}
+
+// readQuery : Run a select on a replica when there is one available, on the primary otherwise
+func (db *Db) readQuery(query string) (*sql.Rows, error) {
+	r := db.pickReplica(query)
+	if r == nil {
+		return db.query(db.readSession(db.session(), query), query)
+	}
+	start := time.Now()
+	rows, err := db.query(db.readSession(r.conn, query), query)
+	db.replicas.observe(r, time.Since(start), err)
+	if err != nil && ErrorClass(err) == ErrorClassConnection {
+		return db.query(db.conn, query)
+	}
+	return rows, err
+}
+
+// readSession : what a select runs on, through the statement cache of the selects for the views preparing them
+func (db *Db) readSession(q queryer, query string) queryer {
+	if db.prepare {
+		return db.preparedIn(db.selects, q, query)
+	}
+	return q
+}
+
+// pickReplica : replica a statement is sent to, nil for the primary
+func (db *Db) pickReplica(query string) *replica {
+	if db.replicas == nil || db.tx != nil {
+		return nil
+	}
+	if ryw, _ := db.Context().Value(readYourWritesKey{}).(bool); ryw {
+		return nil
+	}
+	if operation, _ := statementInfo(query); operation != "select" {
+		return nil
+	}
+	return db.replicas.pick()
+}
+
+// pick : Select an available replica, nil when all are ejected
+func (set *replicaSet) pick() *replica {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	now := time.Now()
+	var best *replica
+	for i := range set.replicas {
+		r := set.replicas[(set.next+i)%len(set.replicas)]
+		if now.Before(r.ejectedUntil) {
+			continue
+		}
+		if set.strategy != LeastLatency {
+			set.next = (set.next + i + 1) % len(set.replicas)
+			return r
+		}
+		if best == nil || r.latency < best.latency {
+			best = r
+		}
+	}
+	return best
+}
+
+// observe : Account the latency of a replica, eject it on connection errors
+func (set *replicaSet) observe(r *replica, latency time.Duration, err error) {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	if err != nil && ErrorClass(err) == ErrorClassConnection {
+		r.ejectedUntil = time.Now().Add(set.eject)
+		return
+	}
+	if r.latency == 0 {
+		r.latency = latency
+		return
+	}
+	r.latency = (4*r.latency + latency) / 5
+}
+
+func (set *replicaSet) close() {
+	for _, r := range set.replicas {
+		r.conn.Close()
+	}
+}
@@ -0,0 +1,142 @@
+package sqldb
+
+import (
+	"database/sql"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy : retry of statements and transactions failing on transient errors, disabled when MaxAttempts <= 1.
+// Reads and WithTx closures are retried, single writes only with RetryWrites as they may have been applied
+type RetryPolicy struct {
+	MaxAttempts int                  // attempts, the first one included
+	BaseDelay   time.Duration        // wait before the first retry, doubled at each retry, 50ms by default
+	MaxDelay    time.Duration        // longest wait, 2s by default
+	RetryWrites bool                 // retry single insert, update, delete and DDL statements too
+	Retryable   func(err error) bool // errors worth a retry, IsTransient by default
+}
+
+// IsTransient : tells if an error may not happen again, deadlocks, serialization failures and lost connections
+func IsTransient(err error) bool {
+	switch ErrorClass(err) {
+	case ErrorClassDeadlock, ErrorClassSerialization, ErrorClassConnection:
+		return true
+	}
+	return false
+}
+
+// session : what the statements of the database run on, its transaction within WithTx, the pool otherwise
+func (db *Db) session() queryer {
+	if db.tx != nil {
+		return db.tx
+	}
+	return db.conn
+}
+
+// WithTx : Run a function in a transaction, committed when the function succeeds and rolled back otherwise.
+// The database given to the function, and its tables, run their statements in the transaction.
+// The whole function is run again on transient failures before the commit, according to the retry policy,
+// a failed commit is returned as is, the server may have applied it. Nested calls join the transaction in progress
+func (db *Db) WithTx(fn func(tx *Db) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
+	for attempt := 1; ; attempt++ {
+		committing, err := db.runTx(fn)
+		if committing || !db.retry(err, attempt, true) {
+			return err
+		}
+	}
+}
+
+// runTx : Run a function in a new transaction, tells if its failure comes from the commit
+func (db *Db) runTx(fn func(tx *Db) error) (bool, error) {
+	// the schema is written unquoted in the search_path and the statements
+	if db.schemaErr != nil {
+		return false, db.schemaErr
+	}
+	tx, err := db.conn.BeginTx(db.Context(), nil)
+	if err != nil {
+		return false, err
+	}
+	view := *db
+	view.tx = tx
+	view.txWrites = make(map[string]bool)
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	// raw queries of a schema view find its tables, for the transaction only
+	if db.schema != "" && db.Driver == "postgres" {
+		if _, err = view.exec(tx, "SET LOCAL search_path TO "+db.schema); err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+	if err = fn(&view); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	err = tx.Commit()
+	// a failed commit may have been applied as well
+	if db.cache != nil {
+		for table := range view.txWrites {
+			db.cache.invalidate(table)
+		}
+	}
+	return true, err
+}
+
+// retry : tells if a failed attempt is to be retried, after waiting for the backoff delay
+func (db *Db) retry(err error, attempt int, idempotent bool) bool {
+	policy := db.Retry
+	if err == nil || attempt >= policy.MaxAttempts || (!idempotent && !policy.RetryWrites) {
+		return false
+	}
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+	if !retryable(err) {
+		return false
+	}
+	base, max := policy.BaseDelay, policy.MaxDelay
+	if base <= 0 {
+		base = 50 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 2 * time.Second
+	}
+	delay := base << uint(attempt-1)
+	if delay > max || delay <= 0 {
+		delay = max
+	}
+	// wait between half and all of the delay, so failed clients do not retry together
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	db.Logger().Warn().Err(err).Str("driver", db.Driver).Int("attempt", attempt).Dur("delay", delay).Msg("retry")
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-db.Context().Done():
+		return false
+	}
+}
+
+// retryStatement : Run a statement, again on transient failures when outside of a transaction
+func (db *Db) retryStatement(q queryer, query string, statement func() error) error {
+	_, inTx := q.(*sql.Tx)
+	if p, ok := q.(*preparedQueryer); ok {
+		inTx = p.tx != nil
+	}
+	operation, _ := statementInfo(query)
+	for attempt := 1; ; attempt++ {
+		err := statement()
+		if inTx || !db.retry(err, attempt, operation == "select") {
+			return err
+		}
+	}
+}
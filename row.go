@@ -0,0 +1,364 @@
+package sqldb
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNullValue : the column holds NULL
+var ErrNullValue = errors.New("null value")
+
+// ErrNoColumn : the row has no such column
+var ErrNoColumn = errors.New("no such column")
+
+// StrictRow : accessors of an AssRow or an OrderedRow reporting NULL, missing columns and conversion failures as errors
+type StrictRow struct {
+	lookup func(column string) (interface{}, bool)
+}
+
+// Strict : Provide the strict accessors of the row
+func (ar *AssRow) Strict() StrictRow {
+	row := *ar
+	return StrictRow{lookup: func(column string) (interface{}, bool) {
+		value, ok := row[column]
+		return value, ok
+	}}
+}
+
+// value : value of a column, errors on NULL or missing column
+func (sr StrictRow) value(column string) (interface{}, error) {
+	value, ok := sr.lookup(column)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", column, ErrNoColumn)
+	}
+	if value == nil {
+		return nil, fmt.Errorf("%s: %w", column, ErrNullValue)
+	}
+	return value, nil
+}
+
+func conversionError(column string, value interface{}, to string) error {
+	return fmt.Errorf("%s: cannot convert %T %v to %s", column, value, value, to)
+}
+
+// String : value of a column as a string
+func (sr StrictRow) String(column string) (string, error) {
+	value, err := sr.value(column)
+	if err != nil {
+		return "", err
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case json.RawMessage:
+		return string(v), nil
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+// Int64 : value of a column as an int64, floats must be integral
+func (sr StrictRow) Int64(column string) (int64, error) {
+	value, err := sr.value(column)
+	if err != nil {
+		return 0, err
+	}
+	switch v := value.(type) {
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, conversionError(column, value, "int64")
+		}
+		return int64(v), nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, conversionError(column, value, "int64")
+		}
+		return int64(v), nil
+	case float32:
+		if float64(v) != math.Trunc(float64(v)) {
+			return 0, conversionError(column, value, "int64")
+		}
+		return int64(v), nil
+	case json.Number:
+		return v.Int64()
+	case []byte, string:
+		str, _ := text(v)
+		i, err := strconv.ParseInt(strings.TrimSpace(str), 10, 64)
+		if err != nil {
+			return 0, conversionError(column, value, "int64")
+		}
+		return i, nil
+	}
+	if i, ok := toInt64(value); ok {
+		return i, nil
+	}
+	return 0, conversionError(column, value, "int64")
+}
+
+// Uint64 : value of a column as an uint64
+func (sr StrictRow) Uint64(column string) (uint64, error) {
+	value, err := sr.value(column)
+	if err != nil {
+		return 0, err
+	}
+	switch v := value.(type) {
+	case uint64:
+		return v, nil
+	case []byte, string, json.Number:
+		str := fmt.Sprintf("%s", v)
+		u, err := strconv.ParseUint(strings.TrimSpace(str), 10, 64)
+		if err != nil {
+			return 0, conversionError(column, value, "uint64")
+		}
+		return u, nil
+	}
+	i, err := sr.Int64(column)
+	if err != nil || i < 0 {
+		return 0, conversionError(column, value, "uint64")
+	}
+	return uint64(i), nil
+}
+
+// Float64 : value of a column as a float64
+func (sr StrictRow) Float64(column string) (float64, error) {
+	value, err := sr.value(column)
+	if err != nil {
+		return 0, err
+	}
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case []byte, string, json.Number:
+		f, err := strconv.ParseFloat(strings.TrimSpace(fmt.Sprintf("%s", v)), 64)
+		if err != nil {
+			return 0, conversionError(column, value, "float64")
+		}
+		return f, nil
+	}
+	if i, ok := toInt64(value); ok {
+		return float64(i), nil
+	}
+	return 0, conversionError(column, value, "float64")
+}
+
+// Bool : value of a column as a bool, numbers are true when not zero
+func (sr StrictRow) Bool(column string) (bool, error) {
+	value, err := sr.value(column)
+	if err != nil {
+		return false, err
+	}
+	b, err := toBool(value)
+	if err != nil {
+		return false, conversionError(column, value, "bool")
+	}
+	return b.(bool), nil
+}
+
+// Time : value of a column as a time.Time, text is parsed
+func (sr StrictRow) Time(column string) (time.Time, error) {
+	value, err := sr.value(column)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if str, ok := text(value); ok {
+		t, err := parseTime(strings.TrimSpace(str), append(timeLayouts, timestampLayouts...))
+		if err != nil {
+			return time.Time{}, conversionError(column, value, "time.Time")
+		}
+		return t, nil
+	}
+	if t, ok := value.(time.Time); ok {
+		return t, nil
+	}
+	return time.Time{}, conversionError(column, value, "time.Time")
+}
+
+// Decimal : value of a numeric column as its exact decimal text
+func (sr StrictRow) Decimal(column string) (string, error) {
+	value, err := sr.value(column)
+	if err != nil {
+		return "", err
+	}
+	switch v := value.(type) {
+	case bool, time.Time:
+		return "", conversionError(column, value, "decimal")
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	}
+	d, err := toDecimal(value)
+	if err != nil {
+		if i, ok := toInt64(value); ok {
+			return strconv.FormatInt(i, 10), nil
+		}
+		return "", conversionError(column, value, "decimal")
+	}
+	if _, err := strconv.ParseFloat(d.(string), 64); err != nil {
+		return "", conversionError(column, value, "decimal")
+	}
+	return d.(string), nil
+}
+
+// Bytes : value of a column as a []byte
+func (sr StrictRow) Bytes(column string) ([]byte, error) {
+	value, err := sr.value(column)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case json.RawMessage:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, conversionError(column, value, "[]byte")
+}
+
+// JSON : Decode the JSON value of a column into v
+func (sr StrictRow) JSON(column string, v interface{}) error {
+	value, err := sr.value(column)
+	if err != nil {
+		return err
+	}
+	raw, ok := text(value)
+	if r, isRaw := value.(json.RawMessage); isRaw {
+		raw, ok = string(r), true
+	}
+	if !ok {
+		// values already decoded by the driver are re-encoded
+		b, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", column, err)
+		}
+		raw = string(b)
+	}
+	err = json.Unmarshal([]byte(raw), v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", column, err)
+	}
+	return nil
+}
+
+// IsNull : tells if the column is NULL or missing
+func (ar *AssRow) IsNull(column string) bool {
+	return (*ar)[column] == nil
+}
+
+// GetStringOk : value of a column as a string, false when NULL or missing
+func (ar *AssRow) GetStringOk(column string) (string, bool) {
+	v, err := ar.Strict().String(column)
+	return v, err == nil
+}
+
+// GetIntOk : value of a column as an int, false when NULL, missing or not an integer
+func (ar *AssRow) GetIntOk(column string) (int, bool) {
+	v, err := ar.Strict().Int64(column)
+	return int(v), err == nil
+}
+
+// GetInt64Ok : value of a column as an int64, false when NULL, missing or not an integer
+func (ar *AssRow) GetInt64Ok(column string) (int64, bool) {
+	v, err := ar.Strict().Int64(column)
+	return v, err == nil
+}
+
+// GetFloatOk : value of a column as a float64, false when NULL, missing or not a number
+func (ar *AssRow) GetFloatOk(column string) (float64, bool) {
+	v, err := ar.Strict().Float64(column)
+	return v, err == nil
+}
+
+// GetBoolOk : value of a column as a bool, false when NULL, missing or not a boolean
+func (ar *AssRow) GetBoolOk(column string) (bool, bool) {
+	v, err := ar.Strict().Bool(column)
+	return v, err == nil
+}
+
+// GetTimeOk : value of a column as a time.Time, false when NULL, missing or not a date
+func (ar *AssRow) GetTimeOk(column string) (time.Time, bool) {
+	v, err := ar.Strict().Time(column)
+	return v, err == nil
+}
+
+// GetInt64 : value of a column as an int64, 0 when NULL or not an integer
+func (ar *AssRow) GetInt64(column string) int64 {
+	v, _ := ar.Strict().Int64(column)
+	return v
+}
+
+// GetUint64 : value of a column as an uint64, 0 when NULL or not an unsigned integer
+func (ar *AssRow) GetUint64(column string) uint64 {
+	v, _ := ar.Strict().Uint64(column)
+	return v
+}
+
+// GetBool : value of a column as a bool, false when NULL or not a boolean
+func (ar *AssRow) GetBool(column string) bool {
+	v, _ := ar.Strict().Bool(column)
+	return v
+}
+
+// GetTime : value of a column as a time.Time, zero time when NULL or not a date
+func (ar *AssRow) GetTime(column string) time.Time {
+	v, _ := ar.Strict().Time(column)
+	return v
+}
+
+// GetDecimal : value of a numeric column as its exact decimal text, empty when NULL or not a number
+func (ar *AssRow) GetDecimal(column string) string {
+	v, _ := ar.Strict().Decimal(column)
+	return v
+}
+
+// GetBytes : value of a column as a []byte, nil when NULL
+func (ar *AssRow) GetBytes(column string) []byte {
+	v, _ := ar.Strict().Bytes(column)
+	return v
+}
+
+// GetJSON : Decode the JSON value of a column into v
+func (ar *AssRow) GetJSON(column string, v interface{}) error {
+	return ar.Strict().JSON(column, v)
+}
+
+// GetNullString : value of a column as a sql.NullString
+func (ar *AssRow) GetNullString(column string) sql.NullString {
+	v, ok := ar.GetStringOk(column)
+	return sql.NullString{String: v, Valid: ok}
+}
+
+// GetNullInt64 : value of a column as a sql.NullInt64
+func (ar *AssRow) GetNullInt64(column string) sql.NullInt64 {
+	v, ok := ar.GetInt64Ok(column)
+	return sql.NullInt64{Int64: v, Valid: ok}
+}
+
+// GetNullFloat64 : value of a column as a sql.NullFloat64
+func (ar *AssRow) GetNullFloat64(column string) sql.NullFloat64 {
+	v, ok := ar.GetFloatOk(column)
+	return sql.NullFloat64{Float64: v, Valid: ok}
+}
+
+// GetNullBool : value of a column as a sql.NullBool
+func (ar *AssRow) GetNullBool(column string) sql.NullBool {
+	v, ok := ar.GetBoolOk(column)
+	return sql.NullBool{Bool: v, Valid: ok}
+}
+
+// GetNullTime : value of a column as a sql.NullTime
+func (ar *AssRow) GetNullTime(column string) sql.NullTime {
+	v, ok := ar.GetTimeOk(column)
+	return sql.NullTime{Time: v, Valid: ok}
+}
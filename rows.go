@@ -0,0 +1,244 @@
+package sqldb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Group : rows sharing the same values of the grouping columns
+type Group struct {
+	Key  []interface{} // normalized values of the grouping columns
+	Rows Rows
+}
+
+// NormalizeKey : comparable form of a value, so keys scanned by different drivers match :
+// integers of any width and integral floats are int64, other floats float64,
+// text and bytes string, even when it looks like a number, times UTC, NULL nil
+func NormalizeKey(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case bool:
+		return v
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < math.MaxInt64 {
+			return int64(v)
+		}
+		return v
+	case float32:
+		return NormalizeKey(float64(v))
+	case uint64:
+		if v > math.MaxInt64 {
+			return v
+		}
+		return int64(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		return v.String()
+	case json.RawMessage:
+		return string(v)
+	case time.Time:
+		return v.UTC()
+	case []byte:
+		// text keeps its leading zeros, "007" is not "7"
+		return string(v)
+	case string:
+		return v
+	}
+	if i, ok := toInt64(value); ok {
+		return i
+	}
+	// slices and maps are not comparable
+	return fmt.Sprintf("%v", value)
+}
+
+// IndexBy : Index the rows by the value of a column, the last row of a value wins, NULL values are skipped
+func (rows Rows) IndexBy(column string) map[interface{}]AssRow {
+	index := make(map[interface{}]AssRow, len(rows))
+	for _, row := range rows {
+		key := NormalizeKey(row[column])
+		if key != nil {
+			index[key] = row
+		}
+	}
+	return index
+}
+
+// GroupBy : Group the rows by the values of some columns, in order of first appearance
+func (rows Rows) GroupBy(columns ...string) []Group {
+	groups := []Group{}
+	positions := make(map[string]int)
+	for _, row := range rows {
+		key := make([]interface{}, len(columns))
+		parts := make([]string, len(columns))
+		for i, column := range columns {
+			key[i] = NormalizeKey(row[column])
+			parts[i] = fmt.Sprintf("%T:%v", key[i], key[i])
+		}
+		id := strings.Join(parts, "\x00")
+		pos, ok := positions[id]
+		if !ok {
+			pos = len(groups)
+			positions[id] = pos
+			groups = append(groups, Group{Key: key})
+		}
+		groups[pos].Rows = append(groups[pos].Rows, row)
+	}
+	return groups
+}
+
+// Pluck : Provide the values of a column
+func (rows Rows) Pluck(column string) []interface{} {
+	values := make([]interface{}, len(rows))
+	for i, row := range rows {
+		values[i] = row[column]
+	}
+	return values
+}
+
+// Filter : Provide the rows matching a predicate
+func (rows Rows) Filter(keep func(row AssRow) bool) Rows {
+	res := Rows{}
+	for _, row := range rows {
+		if keep(row) {
+			res = append(res, row)
+		}
+	}
+	return res
+}
+
+// SortBy : Provide the rows sorted on some columns, descending for columns prefixed with "-", NULL first
+func (rows Rows) SortBy(columns ...string) Rows {
+	res := make(Rows, len(rows))
+	copy(res, rows)
+	sort.SliceStable(res, func(i, j int) bool {
+		for _, column := range columns {
+			desc := strings.HasPrefix(column, "-")
+			column = strings.TrimPrefix(column, "-")
+			c := compareValues(res[i][column], res[j][column])
+			if c == 0 {
+				continue
+			}
+			if desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return res
+}
+
+// JoinOn : Inner join in memory the rows with other rows where leftColumn equals rightColumn.
+// Joined rows hold the columns of both sides, the left value wins on name collision
+func (rows Rows) JoinOn(other Rows, leftColumn string, rightColumn string) Rows {
+	right := make(map[interface{}]Rows)
+	for _, row := range other {
+		key := NormalizeKey(row[rightColumn])
+		if key != nil {
+			right[key] = append(right[key], row)
+		}
+	}
+	res := Rows{}
+	for _, row := range rows {
+		key := NormalizeKey(row[leftColumn])
+		if key == nil {
+			continue
+		}
+		for _, match := range right[key] {
+			joined := make(AssRow, len(row)+len(match))
+			for column, value := range match {
+				joined[column] = value
+			}
+			for column, value := range row {
+				joined[column] = value
+			}
+			res = append(res, joined)
+		}
+	}
+	return res
+}
+
+// compareValues : order of two values, -1, 0 or 1, NULL first and numbers compared whatever their type
+func compareValues(a interface{}, b interface{}) int {
+	a, b = NormalizeKey(a), NormalizeKey(b)
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	if ia, ok := a.(int64); ok {
+		if ib, ok := b.(int64); ok {
+			return compareInts(ia, ib)
+		}
+	}
+	fa, aNum := number(a)
+	fb, bNum := number(b)
+	if aNum && bNum {
+		return compareFloats(fa, fb)
+	}
+	switch va := a.(type) {
+	case time.Time:
+		if vb, ok := b.(time.Time); ok {
+			switch {
+			case va.Before(vb):
+				return -1
+			case va.After(vb):
+				return 1
+			}
+			return 0
+		}
+	case bool:
+		if vb, ok := b.(bool); ok {
+			if va == vb {
+				return 0
+			}
+			if !va {
+				return -1
+			}
+			return 1
+		}
+	}
+	return strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+}
+
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func compareFloats(a float64, b float64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareInts(a int64, b int64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,139 @@
+package sqldb
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidSchema : the schema name is not a plain identifier, statements name schemas unquoted
+var ErrInvalidSchema = errors.New("invalid schema")
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// checkSchema : Check a schema name may be written in a statement
+func checkSchema(name string) error {
+	if !identifier.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidSchema, name)
+	}
+	return nil
+}
+
+// InSchema : Provide a view of the database whose tables, DDL and introspection are in a schema, a database for mysql.
+// The name is written unquoted in the statements, the view fails them with ErrInvalidSchema unless it is a plain identifier
+func (db *Db) InSchema(name string) *Db {
+	view := *db
+	view.schema = name
+	view.schemaErr = nil
+	if name != "" {
+		view.schemaErr = checkSchema(name)
+	}
+	return &view
+}
+
+// Schema : Provide the schema of the database view, empty for the current schema of the connection
+func (db *Db) Schema() string {
+	return db.schema
+}
+
+// ListSchemas : Provide the user schemas of the database, the databases of the server for mysql
+func (db *Db) ListSchemas() ([]string, error) {
+	var query string
+	switch db.Driver {
+	case "postgres":
+		query = "SELECT schema_name :: varchar as name FROM information_schema.schemata WHERE schema_name <> 'information_schema' AND schema_name NOT LIKE 'pg\\_%' ORDER BY schema_name;"
+	case "mysql":
+		query = "SELECT SCHEMA_NAME as name FROM information_schema.SCHEMATA WHERE SCHEMA_NAME NOT IN ('information_schema', 'mysql', 'performance_schema', 'sys') ORDER BY SCHEMA_NAME;"
+	case "sqlserver":
+		query = "SELECT name FROM sys.schemas WHERE name NOT IN ('guest', 'INFORMATION_SCHEMA', 'sys') AND name NOT LIKE 'db[_]%' ORDER BY name;"
+	default:
+		return nil, errors.New("no driver")
+	}
+	rows, err := db.selectRows(query)
+	if err != nil {
+		return nil, err
+	}
+	var schemas []string
+	for _, row := range rows {
+		schemas = append(schemas, row.GetString("name"))
+	}
+	return schemas, nil
+}
+
+// CreateSchema : Create a schema unless it exists, a database for mysql
+func (db *Db) CreateSchema(name string) error {
+	if err := checkSchema(name); err != nil {
+		return err
+	}
+	var query string
+	switch db.Driver {
+	case "postgres", "mysql":
+		query = "CREATE SCHEMA IF NOT EXISTS " + name
+	case "sqlserver":
+		// CREATE SCHEMA must be alone in its batch
+		query = "IF SCHEMA_ID(" + db.quoteLiteral(name) + ") IS NULL EXEC('CREATE SCHEMA " + name + "')"
+	default:
+		return errors.New("no driver")
+	}
+	_, err := db.exec(db.session(), query)
+	return err
+}
+
+// DropSchema : Drop a schema if it exists, with its tables for postgres and mysql, sqlserver requires it to be empty
+func (db *Db) DropSchema(name string) error {
+	if err := checkSchema(name); err != nil {
+		return err
+	}
+	var query string
+	switch db.Driver {
+	case "postgres":
+		query = "DROP SCHEMA IF EXISTS " + name + " CASCADE"
+	case "mysql":
+		query = "DROP SCHEMA IF EXISTS " + name
+	case "sqlserver":
+		query = "DROP SCHEMA IF EXISTS " + name
+	default:
+		return errors.New("no driver")
+	}
+	_, err := db.exec(db.session(), query)
+	if err == nil {
+		db.InvalidateSchema()
+	}
+	return err
+}
+
+// schemaFilter : condition of an introspection query on its schema column, the current schema of the connection when empty
+func (db *Db) schemaFilter(column string, schema string) string {
+	if schema != "" {
+		return column + " = " + db.quoteLiteral(schema)
+	}
+	switch db.Driver {
+	case "mysql":
+		return column + " = DATABASE()"
+	case "sqlserver":
+		return column + " = SCHEMA_NAME()"
+	}
+	return column + " = current_schema()"
+}
+
+// schemaName : schema of the table, the one of its database view when not set
+func (t TableInfo) schemaName() string {
+	if t.Schema == "" && t.db != nil {
+		return t.db.schema
+	}
+	return t.Schema
+}
+
+// qualifiedName : name of the table in statements, prefixed by its schema
+func (t TableInfo) qualifiedName() string {
+	return qualify(t.schemaName(), t.Name)
+}
+
+// qualify : Prefix a name by a schema, unless it has one
+func qualify(schema string, name string) string {
+	if schema == "" || strings.Contains(name, ".") {
+		return name
+	}
+	return schema + "." + name
+}
@@ -0,0 +1,122 @@
+package sqldb
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// schemaCache : table descriptions shared by the views of a database
+type schemaCache struct {
+	mutex  sync.Mutex
+	ttl    time.Duration
+	tables map[string]schemaEntry
+}
+
+type schemaEntry struct {
+	table   TableInfo
+	expires time.Time // zero for no expiry
+}
+
+// EnableSchemaCache : Keep the table descriptions read by GetSchema, as Insert and Update do for every row.
+// They are forgotten after the TTL, unlimited when zero, and when a DDL statement of the package alters their table
+func (db *Db) EnableSchemaCache(ttl time.Duration) {
+	db.schemas = &schemaCache{ttl: ttl, tables: make(map[string]schemaEntry)}
+}
+
+// PreloadSchema : Read the description of every table into the schema cache, enabled if need be
+func (db *Db) PreloadSchema() error {
+	if db.schemas == nil {
+		db.EnableSchemaCache(0)
+	}
+	_, err := db.GetSchema()
+	return err
+}
+
+// InvalidateSchema : Forget the cached descriptions of some tables, of every table when none is given
+func (db *Db) InvalidateSchema(tables ...string) {
+	if db.schemas == nil {
+		return
+	}
+	db.schemas.mutex.Lock()
+	defer db.schemas.mutex.Unlock()
+	if len(tables) == 0 {
+		db.schemas.tables = make(map[string]schemaEntry)
+		return
+	}
+	// every schema's table of that name, DDL statements may leave the schema implicit
+	for _, table := range tables {
+		for key := range db.schemas.tables {
+			if cacheTable(key) == cacheTable(table) {
+				delete(db.schemas.tables, key)
+			}
+		}
+	}
+}
+
+// invalidateSchema : Forget the description of a table altered by a DDL statement
+func (db *Db) invalidateSchema(event *QueryEvent) {
+	if db.schemas == nil || event.Err != nil {
+		return
+	}
+	operation, table := statementInfo(event.Query)
+	if operation != "ddl" {
+		return
+	}
+	if table == "" {
+		db.InvalidateSchema()
+		return
+	}
+	db.InvalidateSchema(table)
+}
+
+// get : cached description of a table
+func (c *schemaCache) get(key string) (*TableInfo, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.tables[key]
+	if !ok || (!entry.expires.IsZero() && time.Now().After(entry.expires)) {
+		return nil, false
+	}
+	ti := entry.table.copy()
+	return &ti, true
+}
+
+// set : Cache the description of a table
+func (c *schemaCache) set(ti *TableInfo) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry := schemaEntry{table: ti.copy()}
+	if c.ttl > 0 {
+		entry.expires = time.Now().Add(c.ttl)
+	}
+	c.tables[ti.schemaKey()] = entry
+}
+
+// copy : copy of a table description, so callers may alter it
+func (t TableInfo) copy() TableInfo {
+	columns := make(map[string]string, len(t.Columns))
+	for name, sqltype := range t.Columns {
+		columns[name] = sqltype
+	}
+	t.Columns = columns
+	t.order = append([]string(nil), t.order...)
+	return t
+}
+
+// schemaKey : key of the table in the schema cache, its lower case qualified name
+func (t *TableInfo) schemaKey() string {
+	return strings.ToLower(t.qualifiedName())
+}
+
+// cachedSchema : description of the table from the schema cache, when enabled
+func (t *TableInfo) cachedSchema() (*TableInfo, bool) {
+	if t.db.schemas == nil || strings.TrimSpace(t.Name) == "" {
+		return nil, false
+	}
+	ti, ok := t.db.schemas.get(t.schemaKey())
+	if ok {
+		ti.db = t.db
+	}
+	return ti, ok
+}
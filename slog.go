@@ -0,0 +1,72 @@
+//go:build go1.21
+
+package sqldb
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// SetSlogHandler : Log the statements and the failures of the database with a log/slog handler, as SetLogger does
+func (db *Db) SetSlogHandler(handler slog.Handler) {
+	db.SetLogger(zerolog.New(slogWriter{handler: handler}).With().Timestamp().Logger())
+}
+
+// slogWriter : zerolog output handing each event over to a slog handler as a record
+type slogWriter struct {
+	handler slog.Handler
+}
+
+// slogLevels : slog level of each zerolog level
+var slogLevels = map[string]slog.Level{
+	"trace": slog.LevelDebug - 4,
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+	"fatal": slog.LevelError + 4,
+	"panic": slog.LevelError + 8,
+}
+
+func (w slogWriter) Write(p []byte) (int, error) {
+	var event map[string]interface{}
+	if err := json.Unmarshal(p, &event); err != nil {
+		return 0, err
+	}
+	level, ok := slogLevels[stringField(event, zerolog.LevelFieldName)]
+	if !ok {
+		level = slog.LevelInfo
+	}
+	ctx := context.Background()
+	if !w.handler.Enabled(ctx, level) {
+		return len(p), nil
+	}
+	stamp := time.Now()
+	if t, err := time.Parse(zerolog.TimeFieldFormat, stringField(event, zerolog.TimestampFieldName)); err == nil {
+		stamp = t
+	}
+	record := slog.NewRecord(stamp, level, stringField(event, zerolog.MessageFieldName), 0)
+	delete(event, zerolog.LevelFieldName)
+	delete(event, zerolog.MessageFieldName)
+	delete(event, zerolog.TimestampFieldName)
+	keys := make([]string, 0, len(event))
+	for key := range event {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		record.AddAttrs(slog.Any(key, event[key]))
+	}
+	return len(p), w.handler.Handle(ctx, record)
+}
+
+// stringField : string field of a zerolog event, empty when missing
+func stringField(event map[string]interface{}, key string) string {
+	str, _ := event[key].(string)
+	return str
+}
@@ -0,0 +1,24 @@
+//go:build go1.21
+
+package sqldb
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	db := &Db{Driver: "postgres", LogQueries: true}
+	db.SetSlogHandler(slog.NewTextHandler(&buf, nil))
+	db.logStatement(&QueryEvent{Query: "SELECT * FROM survey WHERE id = 3", RowsAffected: -1, Err: errors.New("failed")})
+	line := buf.String()
+	for _, part := range []string{"level=ERROR", `msg="SELECT * FROM survey WHERE id = ?"`, "table=survey", "error=failed"} {
+		if !strings.Contains(line, part) {
+			t.Errorf("Missing %s in %s", part, line)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SlowQueryOptions : detection of slow statements, disabled when Threshold is zero
+type SlowQueryOptions struct {
+	Threshold time.Duration
+	Explain   bool            // capture the plan of slow select, insert, update and delete statements run outside of a transaction
+	Callback  func(SlowQuery) // called for each slow statement, they are logged as warnings anyway
+}
+
+// SlowQuery : a statement slower than the threshold
+type SlowQuery struct {
+	Query    string
+	Duration time.Duration
+	Plan     *PlanSummary // nil when no plan was captured
+	PlanErr  error        // failure to capture the plan
+}
+
+// PlanSummary : outline of a statement plan
+type PlanSummary struct {
+	SeqScans      []string // tables read in full
+	EstimatedRows float64  // rows the planner expects the statement to produce
+	Cost          float64  // planner cost, in the unit of the dialect
+	Raw           string   // plan as given by the database, JSON or XML
+}
+
+// slowQuery : Record a statement when slower than the threshold.
+// The plan is captured from a goroutine on a connection of the pool, the statement may still hold its own with unread rows,
+// so its report is logged and given to the callback once the plan is there
+func (db *Db) slowQuery(event *QueryEvent) {
+	opts := db.SlowQuery
+	if opts.Threshold <= 0 || event.Duration < opts.Threshold {
+		return
+	}
+	slow := SlowQuery{Query: event.Query, Duration: event.Duration}
+	operation, _ := statementInfo(event.Query)
+	// a transaction holds its connection and sees its own changes, its statements are reported without plan
+	if !opts.Explain || db.tx != nil || len(event.Args) > 0 || (operation != "select" && operation != "insert" && operation != "update" && operation != "delete") {
+		db.reportSlowQuery(slow)
+		return
+	}
+	select {
+	case explainSlots <- struct{}{}:
+	default:
+		slow.PlanErr = errors.New("slow query: too many plans being captured")
+		db.reportSlowQuery(slow)
+		return
+	}
+	// the context of the statement may end with it
+	view := db.WithContext(context.Background())
+	go func() {
+		defer func() { <-explainSlots }()
+		slow.Plan, slow.PlanErr = view.Explain(slow.Query)
+		view.reportSlowQuery(slow)
+	}()
+}
+
+// explainSlots : plans captured at once, the slow queries beyond are reported without plan
+var explainSlots = make(chan struct{}, 4)
+
+// reportSlowQuery : Log a slow statement and give it to the callback
+func (db *Db) reportSlowQuery(slow SlowQuery) {
+	logger := db.Logger()
+	e := logger.Warn().Str("driver", db.Driver).Dur("duration", slow.Duration)
+	if slow.Plan != nil {
+		e = e.Strs("seq_scans", slow.Plan.SeqScans).Float64("estimated_rows", slow.Plan.EstimatedRows).Float64("cost", slow.Plan.Cost)
+	}
+	if slow.PlanErr != nil {
+		e = e.AnErr("plan_error", slow.PlanErr)
+	}
+	query := slow.Query
+	if !db.LogValues {
+		query = SanitizeQuery(query)
+	}
+	e.Msg("slow query: " + query)
+	if db.SlowQuery.Callback != nil {
+		db.SlowQuery.Callback(slow)
+	}
+}
+
+// Explain : Provide the plan the database would use for a statement, the statement is not run
+func (db *Db) Explain(query string) (*PlanSummary, error) {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	switch db.Driver {
+	case "postgres":
+		raw, err := db.explainQuery("EXPLAIN (FORMAT JSON) " + query)
+		if err != nil {
+			return nil, err
+		}
+		return pgPlanSummary(raw)
+	case "mysql":
+		raw, err := db.explainQuery("EXPLAIN FORMAT=JSON " + query)
+		if err != nil {
+			return nil, err
+		}
+		return myPlanSummary(raw)
+	case "sqlserver":
+		raw, err := db.msShowPlan(query)
+		if err != nil {
+			return nil, err
+		}
+		return msPlanSummary(raw)
+	}
+	return nil, errors.New("no driver")
+}
+
+// explainQuery : Run an EXPLAIN statement, outside of the hooks so it is not itself reported
+func (db *Db) explainQuery(query string) (string, error) {
+	var raw []byte
+	err := db.conn.QueryRowContext(db.Context(), query).Scan(&raw)
+	return string(raw), err
+}
+
+// msShowPlan : sqlserver gives the plan of the statements run on a session with SHOWPLAN_XML
+func (db *Db) msShowPlan(query string) (string, error) {
+	ctx := db.Context()
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, "SET SHOWPLAN_XML ON"); err != nil {
+		return "", err
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, "SET SHOWPLAN_XML OFF"); err != nil {
+			// the connection would give plans instead of running the statements, it is not given back to the pool
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+	}()
+	var raw string
+	err = conn.QueryRowContext(ctx, query).Scan(&raw)
+	return raw, err
+}
+
+// pgPlanSummary : summarize a postgres JSON plan
+func pgPlanSummary(raw string) (*PlanSummary, error) {
+	var plans []struct {
+		Plan map[string]interface{} `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(raw), &plans); err != nil {
+		return nil, err
+	}
+	summary := &PlanSummary{Raw: raw}
+	if len(plans) == 0 {
+		return summary, nil
+	}
+	top := plans[0].Plan
+	summary.EstimatedRows, _ = top["Plan Rows"].(float64)
+	summary.Cost, _ = top["Total Cost"].(float64)
+	var walk func(node map[string]interface{})
+	walk = func(node map[string]interface{}) {
+		if node["Node Type"] == "Seq Scan" {
+			if relation, ok := node["Relation Name"].(string); ok {
+				summary.SeqScans = append(summary.SeqScans, relation)
+			}
+		}
+		children, _ := node["Plans"].([]interface{})
+		for _, child := range children {
+			if c, ok := child.(map[string]interface{}); ok {
+				walk(c)
+			}
+		}
+	}
+	walk(top)
+	return summary, nil
+}
+
+// myPlanSummary : summarize a mysql JSON plan, tables of access type ALL are read in full
+func myPlanSummary(raw string) (*PlanSummary, error) {
+	var plan map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &plan); err != nil {
+		return nil, err
+	}
+	summary := &PlanSummary{Raw: raw}
+	block, _ := plan["query_block"].(map[string]interface{})
+	if costInfo, ok := block["cost_info"].(map[string]interface{}); ok {
+		summary.Cost = planNumber(costInfo["query_cost"])
+	}
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if name, ok := v["table_name"].(string); ok {
+				if v["access_type"] == "ALL" {
+					summary.SeqScans = append(summary.SeqScans, name)
+				}
+				if rows := planNumber(v["rows_produced_per_join"]); rows > summary.EstimatedRows {
+					summary.EstimatedRows = rows
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(block)
+	return summary, nil
+}
+
+// msPlanSummary : summarize a sqlserver XML showplan, table and clustered index scans read tables in full
+func msPlanSummary(raw string) (*PlanSummary, error) {
+	summary := &PlanSummary{Raw: raw}
+	dec := xml.NewDecoder(strings.NewReader(raw))
+	first := true
+	scanning := false
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return summary, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch element.Name.Local {
+		case "RelOp":
+			attributes := make(map[string]string)
+			for _, attr := range element.Attr {
+				attributes[attr.Name.Local] = attr.Value
+			}
+			if first {
+				summary.EstimatedRows = planNumber(attributes["EstimateRows"])
+				summary.Cost = planNumber(attributes["EstimatedTotalSubtreeCost"])
+				first = false
+			}
+			scanning = attributes["PhysicalOp"] == "Table Scan" || attributes["PhysicalOp"] == "Clustered Index Scan"
+		case "Object":
+			if !scanning {
+				continue
+			}
+			for _, attr := range element.Attr {
+				if attr.Name.Local == "Table" {
+					summary.SeqScans = append(summary.SeqScans, strings.Trim(attr.Value, "[]"))
+				}
+			}
+			scanning = false
+		}
+	}
+}
+
+// planNumber : number of a plan attribute, given as a number or as text
+func planNumber(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	}
+	return 0
+}
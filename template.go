@@ -0,0 +1,351 @@
+package sqldb
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// TemplateOptions : tune template based generation
+type TemplateOptions struct {
+	Text  bool                   // use text/template, the output is not HTML escaped
+	Funcs map[string]interface{} // functions added to, or replacing, TemplateFuncs
+	FS    fs.FS                  // file system the template is read from, the disk when nil
+}
+
+// TemplateData : context of schema templates
+type TemplateData struct {
+	Driver      string
+	Tbl         []TableInfo // raw tables, kept for existing templates
+	Lnk         []Link      // links from the <table>_id naming convention, kept for existing templates
+	Tables      []TemplateTable
+	Links       []Link
+	ForeignKeys []ForeignKey
+	Indexes     []Index
+}
+
+// TemplateTable : context of table templates, Name and Columns are the raw table description
+type TemplateTable struct {
+	TableInfo
+	Fields       []TemplateColumn // columns in ordinal position
+	Links        []Link           // references to other tables
+	ReferencedBy []Link           // references from other tables
+	Indexes      []Index
+}
+
+// TemplateColumn : column description given to templates
+type TemplateColumn struct {
+	Name       string
+	Type       string
+	Comment    string
+	Nullable   bool
+	PrimaryKey bool
+	ForeignKey *Link // nil when the column references no table
+}
+
+// OutputFS : destination of generated files
+type OutputFS interface {
+	Create(name string) (io.WriteCloser, error)
+}
+
+// OutputDir : OutputFS writing into a folder of the disk
+type OutputDir string
+
+// Create : Create a file in the folder
+func (dir OutputDir) Create(name string) (io.WriteCloser, error) {
+	return os.Create(filepath.Join(string(dir), name))
+}
+
+// MemoryFS : OutputFS keeping the generated files in memory, by name
+type MemoryFS map[string]*bytes.Buffer
+
+// Create : Create or truncate a file
+func (m MemoryFS) Create(name string) (io.WriteCloser, error) {
+	buf := &bytes.Buffer{}
+	m[name] = buf
+	return nopCloser{buf}, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// executor : parsed text or html template
+type executor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// parseTemplate : parse a template file with the helper functions
+func (db *Db) parseTemplate(filename string, opts TemplateOptions) (executor, error) {
+	funcs := db.TemplateFuncs()
+	for name, fn := range opts.Funcs {
+		funcs[name] = fn
+	}
+	name := filepath.Base(filename)
+	if opts.FS != nil {
+		name = path.Base(filename)
+	}
+	if opts.Text {
+		t := template.New(name).Funcs(funcs)
+		if opts.FS != nil {
+			return t.ParseFS(opts.FS, filename)
+		}
+		return t.ParseFiles(filename)
+	}
+	t := htmltemplate.New(name).Funcs(funcs)
+	if opts.FS != nil {
+		return t.ParseFS(opts.FS, filename)
+	}
+	return t.ParseFiles(filename)
+}
+
+// ExecuteSchemaTemplate : Render a template of the whole schema into a writer
+func (db *Db) ExecuteSchemaTemplate(w io.Writer, templateFilename string, opts TemplateOptions) error {
+	t, data, err := db.schemaTemplate(templateFilename, opts)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, data)
+}
+
+// schemaTemplate : Parse a template and read the schema it renders, before any output is created
+func (db *Db) schemaTemplate(templateFilename string, opts TemplateOptions) (executor, *TemplateData, error) {
+	t, err := db.parseTemplate(templateFilename, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := db.TemplateData()
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, data, nil
+}
+
+// ExecuteTableTemplates : Render a template once per table, into <table>.<extension> files
+func (db *Db) ExecuteTableTemplates(out OutputFS, templateFilename string, extension string, opts TemplateOptions) error {
+	t, err := db.parseTemplate(templateFilename, opts)
+	if err != nil {
+		return err
+	}
+	data, err := db.TemplateData()
+	if err != nil {
+		return err
+	}
+	for _, table := range data.Tables {
+		f, err := out.Create(table.Name + "." + extension)
+		if err != nil {
+			return err
+		}
+		err = t.Execute(f, table)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TemplateData : Provide the schema with its links, foreign keys and indexes, as given to templates
+func (db *Db) TemplateData() (*TemplateData, error) {
+	schema, err := db.GetSchema()
+	if err != nil {
+		return nil, err
+	}
+	links, err := db.schemaLinks(schema)
+	if err != nil {
+		return nil, err
+	}
+	fks, err := db.ForeignKeys()
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := db.Indexes()
+	if err != nil {
+		return nil, err
+	}
+	nullable, err := db.nullableColumns()
+	if err != nil {
+		return nil, err
+	}
+	data := &TemplateData{
+		Driver:      db.Driver,
+		Tbl:         schema,
+		Lnk:         buildLinks(schema),
+		Links:       links,
+		ForeignKeys: fks,
+		Indexes:     indexes,
+	}
+	for _, ti := range schema {
+		table := TemplateTable{TableInfo: ti}
+		for _, link := range links {
+			if link.Source == ti.Name {
+				table.Links = append(table.Links, link)
+			}
+			if link.Destination == ti.Name {
+				table.ReferencedBy = append(table.ReferencedBy, link)
+			}
+		}
+		for _, index := range indexes {
+			if index.Table == ti.Name {
+				table.Indexes = append(table.Indexes, index)
+			}
+		}
+		for _, name := range ti.ColumnNames() {
+			desc := strings.SplitN(ti.Columns[name], "|", 2)
+			column := TemplateColumn{Name: name, Type: desc[0], Nullable: nullable[ti.Name][name], PrimaryKey: name == "id"}
+			if len(desc) > 1 {
+				column.Comment = desc[1]
+			}
+			for i := range table.Links {
+				if table.Links[i].SourceColumn == name {
+					column.ForeignKey = &table.Links[i]
+				}
+			}
+			table.Fields = append(table.Fields, column)
+		}
+		data.Tables = append(data.Tables, table)
+	}
+	return data, nil
+}
+
+// TemplateFuncs : Provide the helper functions available in templates
+func (db *Db) TemplateFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"camelCase":  camelCase,
+		"pascalCase": pascalCase,
+		"snakeCase":  snakeCase,
+		"pluralize":  pluralize,
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"join":       strings.Join,
+		"goType":     func(sqltype string) string { return goType(db.Driver, sqltype) },
+		"tsType":     func(sqltype string) string { return tsType(db.Driver, sqltype) },
+		"sqlType":    func(sqltype string) string { return strings.SplitN(sqltype, "|", 2)[0] },
+		"comment": func(sqltype string) string {
+			desc := strings.SplitN(sqltype, "|", 2)
+			if len(desc) > 1 {
+				return desc[1]
+			}
+			return ""
+		},
+		"sortedKeys": func(columns map[string]string) []string {
+			keys := make([]string, 0, len(columns))
+			for key := range columns {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			return keys
+		},
+	}
+}
+
+// words : split an identifier on underscores, dashes, spaces and case changes
+func words(str string) []string {
+	var res []string
+	var current []rune
+	runes := []rune(str)
+	for i, r := range runes {
+		if r == '_' || r == '-' || r == ' ' {
+			if len(current) > 0 {
+				res = append(res, string(current))
+			}
+			current = nil
+			continue
+		}
+		if unicode.IsUpper(r) && len(current) > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			res = append(res, string(current))
+			current = nil
+		}
+		current = append(current, r)
+	}
+	if len(current) > 0 {
+		res = append(res, string(current))
+	}
+	return res
+}
+
+func pascalCase(str string) string {
+	var res strings.Builder
+	for _, word := range words(str) {
+		runes := []rune(strings.ToLower(word))
+		runes[0] = unicode.ToUpper(runes[0])
+		res.WriteString(string(runes))
+	}
+	return res.String()
+}
+
+func camelCase(str string) string {
+	runes := []rune(pascalCase(str))
+	if len(runes) > 0 {
+		runes[0] = unicode.ToLower(runes[0])
+	}
+	return string(runes)
+}
+
+func snakeCase(str string) string {
+	parts := words(str)
+	for i := range parts {
+		parts[i] = strings.ToLower(parts[i])
+	}
+	return strings.Join(parts, "_")
+}
+
+// pluralize : English plural of a word
+func pluralize(str string) string {
+	lower := strings.ToLower(str)
+	switch {
+	case lower == "":
+		return str
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		return str[:len(str)-1] + "ies"
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"), strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return str + "es"
+	}
+	return str + "s"
+}
+
+var goTypes = map[string]string{
+	"integer": "int64", "bigint": "int64", "smallint": "int64", "boolean": "bool",
+	"real": "float32", "double": "float64", "decimal": "float64",
+	"varchar": "string", "char": "string", "text": "string", "uuid": "string",
+	"date": "time.Time", "time": "time.Time", "timestamp": "time.Time", "timestamptz": "time.Time",
+	"binary": "[]byte", "json": "json.RawMessage",
+}
+
+var tsTypes = map[string]string{
+	"integer": "number", "bigint": "number", "smallint": "number", "boolean": "boolean",
+	"real": "number", "double": "number", "decimal": "string",
+	"varchar": "string", "char": "string", "text": "string", "uuid": "string",
+	"date": "Date", "time": "string", "timestamp": "Date", "timestamptz": "Date",
+	"binary": "Uint8Array", "json": "unknown",
+}
+
+// goType : Go type of a column type
+func goType(driver string, sqltype string) string {
+	base, args, _ := splitType(sqltype)
+	generic, _ := genericType(driver, base, args)
+	if t, ok := goTypes[generic]; ok {
+		return t
+	}
+	return "interface{}"
+}
+
+// tsType : TypeScript type of a column type
+func tsType(driver string, sqltype string) string {
+	base, args, _ := splitType(sqltype)
+	generic, _ := genericType(driver, base, args)
+	if t, ok := tsTypes[generic]; ok {
+		return t
+	}
+	return "unknown"
+}
@@ -0,0 +1,253 @@
+package sqldb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoTenant : the context carries no tenant
+var ErrNoTenant = errors.New("no tenant")
+
+// ErrInvalidTenant : the tenant name is not a plain identifier, and can't name a schema
+var ErrInvalidTenant = errors.New("invalid tenant")
+
+type tenantKey struct{}
+
+// WithTenant : Provide a context carrying a tenant, for ForTenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext : Provide the tenant carried by a context
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// SetTenantPrefix : Name the schemas of the tenants prefix + tenant, the prefix must start a plain identifier
+func (db *Db) SetTenantPrefix(prefix string) error {
+	if prefix != "" {
+		if err := checkSchema(prefix); err != nil {
+			return err
+		}
+	}
+	db.tenantPrefix = prefix
+	return nil
+}
+
+// TenantPrefix : Provide the prefix of the schemas of the tenants
+func (db *Db) TenantPrefix() string {
+	return db.tenantPrefix
+}
+
+// TenantSchema : Provide the schema of a tenant, the database for mysql, named TenantPrefix + tenant
+func (db *Db) TenantSchema(tenant string) (string, error) {
+	if !identifier.MatchString(tenant) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidTenant, tenant)
+	}
+	schema := db.tenantPrefix + tenant
+	if err := checkSchema(schema); err != nil {
+		return "", err
+	}
+	return schema, nil
+}
+
+// Tenant : Provide the view of the database in the schema of a tenant
+func (db *Db) Tenant(tenant string) (*Db, error) {
+	schema, err := db.TenantSchema(tenant)
+	if err != nil {
+		return nil, err
+	}
+	return db.InSchema(schema), nil
+}
+
+// ForTenant : Provide the view of the database in the schema of the tenant carried by a context, running in that context.
+// Its tables qualify their names with the schema. On postgres its raw queries run in a transaction setting the search_path,
+// on mysql and sqlserver they must qualify their tables, the connections keep their default database or schema
+func (db *Db) ForTenant(ctx context.Context) (*Db, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	view, err := db.Tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+	return view.WithContext(ctx), nil
+}
+
+// ListTenants : Provide the tenants having a schema, the schemas named with TenantPrefix, or every user schema but public and dbo without prefix
+func (db *Db) ListTenants() ([]string, error) {
+	schemas, err := db.ListSchemas()
+	if err != nil {
+		return nil, err
+	}
+	var tenants []string
+	for _, schema := range schemas {
+		if !strings.HasPrefix(schema, db.tenantPrefix) {
+			continue
+		}
+		if db.tenantPrefix == "" && (schema == "public" || schema == "dbo") {
+			continue
+		}
+		tenant := strings.TrimPrefix(schema, db.tenantPrefix)
+		if identifier.MatchString(tenant) {
+			tenants = append(tenants, tenant)
+		}
+	}
+	sort.Strings(tenants)
+	return tenants, nil
+}
+
+// ProvisionTenant : Create the schema of a tenant and the tables of a JSON schema file, as ImportSchema reads it.
+// Unlike ImportSchema it stops on the first error, the tables being created in a transaction where DDL allows it
+func (db *Db) ProvisionTenant(tenant string, filename string) error {
+	byteValue, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var jsonSource []TableInfo
+	if err = json.Unmarshal(byteValue, &jsonSource); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	view, err := db.Tenant(tenant)
+	if err != nil {
+		return err
+	}
+	if err = db.CreateSchema(view.schema); err != nil {
+		return err
+	}
+	return view.WithTx(func(tx *Db) error {
+		for _, ti := range jsonSource {
+			if err := tx.CreateTable(ti); err != nil {
+				return fmt.Errorf("table %s: %w", ti.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// DropTenant : Drop the schema of a tenant and its tables
+func (db *Db) DropTenant(tenant string) error {
+	schema, err := db.TenantSchema(tenant)
+	if err != nil {
+		return err
+	}
+	return db.DropSchema(schema)
+}
+
+// MigrationProgress : progress of MigrateTenants, reported once per tenant
+type MigrationProgress struct {
+	Tenant   string
+	Done     int // tenants processed so far, this one included
+	Total    int
+	Duration time.Duration
+	Err      error
+}
+
+// MigrateOptions : tenants a migration applies to and how
+type MigrateOptions struct {
+	Tenants     []string // every tenant of ListTenants when empty
+	Concurrency int      // tenants migrated at once, 1 by default
+	StopOnError bool     // leave the remaining tenants aside after a failure
+	Progress    func(progress MigrationProgress)
+}
+
+// MigrationError : tenants a migration failed for, by tenant
+type MigrationError struct {
+	Errors  map[string]error
+	Skipped []string // tenants left aside after a failure or a cancellation
+}
+
+func (e *MigrationError) Error() string {
+	tenants := make([]string, 0, len(e.Errors))
+	for tenant := range e.Errors {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	msg := fmt.Sprintf("migration failed for %d tenants", len(tenants))
+	for _, tenant := range tenants {
+		msg += fmt.Sprintf("; %s: %v", tenant, e.Errors[tenant])
+	}
+	if len(e.Skipped) > 0 {
+		msg += fmt.Sprintf("; %d tenants skipped", len(e.Skipped))
+	}
+	return msg
+}
+
+// MigrateTenants : Apply a migration to the schema of every tenant, each in its own transaction.
+// Returns a *MigrationError when it failed for some tenants
+func (db *Db) MigrateTenants(opts MigrateOptions, migration func(tenant *Db) error) error {
+	tenants := opts.Tenants
+	if len(tenants) == 0 {
+		var err error
+		if tenants, err = db.ListTenants(); err != nil {
+			return err
+		}
+	}
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = 1
+	}
+	var mutex sync.Mutex
+	failure := &MigrationError{Errors: make(map[string]error)}
+	done, stop := 0, false
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tenant := range queue {
+				start := time.Now()
+				err := db.migrateTenant(tenant, migration)
+				mutex.Lock()
+				done++
+				if err != nil {
+					failure.Errors[tenant] = err
+					stop = stop || opts.StopOnError
+				}
+				if opts.Progress != nil {
+					opts.Progress(MigrationProgress{Tenant: tenant, Done: done, Total: len(tenants), Duration: time.Since(start), Err: err})
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for i, tenant := range tenants {
+		mutex.Lock()
+		stopped := stop || db.Context().Err() != nil
+		mutex.Unlock()
+		if stopped {
+			failure.Skipped = append(failure.Skipped, tenants[i:]...)
+			break
+		}
+		queue <- tenant
+	}
+	close(queue)
+	wg.Wait()
+	if len(failure.Errors) > 0 || len(failure.Skipped) > 0 {
+		return failure
+	}
+	return nil
+}
+
+// migrateTenant : Apply a migration to a tenant in a transaction
+func (db *Db) migrateTenant(tenant string, migration func(tenant *Db) error) error {
+	view, err := db.Tenant(tenant)
+	if err != nil {
+		return err
+	}
+	err = view.WithTx(migration)
+	if err != nil {
+		db.Logger().Error().Err(err).Str("tenant", tenant).Msg("migrate tenant")
+	}
+	return err
+}
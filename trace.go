@@ -0,0 +1,165 @@
+package sqldb
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer : starts the spans of the statements, to be backed by OpenTelemetry or any tracing library
+type Tracer interface {
+	Start(ctx context.Context, name string, attributes map[string]string) (context.Context, Span)
+}
+
+// Span : a traced statement
+type Span interface {
+	RecordError(err error)
+	SetAttribute(key string, value string)
+	End()
+}
+
+// SetTracer : Open a span around every statement of the database, as a child of the span of its context
+func (db *Db) SetTracer(tracer Tracer) {
+	db.tracer = tracer
+}
+
+// dbSystems : OpenTelemetry db.system of the drivers
+var dbSystems = map[string]string{"postgres": "postgresql", "mysql": "mysql", "sqlserver": "mssql"}
+
+// statementSpan : span of a running statement, nil when the database is not traced
+type statementSpan struct {
+	span Span
+}
+
+// startSpan : Open the span of a statement and make its context the context of the statement
+func (db *Db) startSpan(event *QueryEvent) *statementSpan {
+	if db.tracer == nil {
+		return nil
+	}
+	operation, table := statementInfo(event.Query)
+	system, ok := dbSystems[db.Driver]
+	if !ok {
+		system = db.Driver
+	}
+	attributes := map[string]string{
+		"db.system":    system,
+		"db.name":      databaseName(db.Driver, db.Url),
+		"db.operation": operation,
+		"db.statement": SanitizeQuery(event.Query),
+	}
+	name := operation
+	if table != "" {
+		attributes["db.sql.table"] = table
+		name += " " + table
+	}
+	ctx, span := db.tracer.Start(event.Context, name, attributes)
+	event.Context = ctx
+	return &statementSpan{span: span}
+}
+
+// finish : Close the span, recording the error of the statement
+func (s *statementSpan) finish(err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetAttribute("error.type", ErrorClass(err))
+	}
+	s.span.End()
+}
+
+// databaseName : name of the database of a connection string
+func databaseName(driver string, dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" && u.Host != "" {
+		if name := u.Query().Get("database"); name != "" {
+			return name
+		}
+		return strings.TrimPrefix(u.Path, "/")
+	}
+	switch driver {
+	case "mysql":
+		// user:password@tcp(host:port)/dbname?params
+		if i := strings.LastIndex(dsn, "/"); i >= 0 {
+			return strings.SplitN(dsn[i+1:], "?", 2)[0]
+		}
+	case "postgres", "sqlserver":
+		// key=value pairs, separated by spaces or semicolons
+		for _, pair := range strings.FieldsFunc(dsn, func(r rune) bool { return r == ' ' || r == ';' }) {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) == 2 && (strings.EqualFold(kv[0], "dbname") || strings.EqualFold(kv[0], "database")) {
+				return kv[1]
+			}
+		}
+	}
+	return ""
+}
+
+// SpanRecorder : Tracer keeping the spans in memory, for tests
+type SpanRecorder struct {
+	mutex sync.Mutex
+	spans []*RecordedSpan
+}
+
+// RecordedSpan : a span kept by a SpanRecorder
+type RecordedSpan struct {
+	Name       string
+	Parent     *RecordedSpan // span of the context the span was started in
+	Attributes map[string]string
+	Err        error
+	Started    time.Time
+	Ended      time.Time // zero while the span is running
+	recorder   *SpanRecorder
+}
+
+type recordedSpanKey struct{}
+
+// ContextWithSpan : Provide a context carrying a recorded span, so spans started in it are its children
+func ContextWithSpan(ctx context.Context, span *RecordedSpan) context.Context {
+	return context.WithValue(ctx, recordedSpanKey{}, span)
+}
+
+// Start : Start a span, child of the recorded span of the context if any
+func (r *SpanRecorder) Start(ctx context.Context, name string, attributes map[string]string) (context.Context, Span) {
+	span := &RecordedSpan{Name: name, Attributes: make(map[string]string), Started: time.Now(), recorder: r}
+	span.Parent, _ = ctx.Value(recordedSpanKey{}).(*RecordedSpan)
+	for key, value := range attributes {
+		span.Attributes[key] = value
+	}
+	r.mutex.Lock()
+	r.spans = append(r.spans, span)
+	r.mutex.Unlock()
+	return ContextWithSpan(ctx, span), span
+}
+
+// Spans : Provide the recorded spans, in start order
+func (r *SpanRecorder) Spans() []*RecordedSpan {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	spans := make([]*RecordedSpan, len(r.spans))
+	copy(spans, r.spans)
+	return spans
+}
+
+// RecordError : Record the error of the span
+func (s *RecordedSpan) RecordError(err error) {
+	s.recorder.mutex.Lock()
+	defer s.recorder.mutex.Unlock()
+	s.Err = err
+}
+
+// SetAttribute : Set an attribute of the span
+func (s *RecordedSpan) SetAttribute(key string, value string) {
+	s.recorder.mutex.Lock()
+	defer s.recorder.mutex.Unlock()
+	s.Attributes[key] = value
+}
+
+// End : End the span
+func (s *RecordedSpan) End() {
+	s.recorder.mutex.Lock()
+	defer s.recorder.mutex.Unlock()
+	s.Ended = time.Now()
+}